@@ -0,0 +1,479 @@
+package hue
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version of the backup format written by Bridge.Backup.
+const backupVersion = 1
+
+// Matches references to resources like /sensors/5/state/buttonevent. Schedule
+// commands additionally contain the username, e.g. /api/<username>/lights/3/state.
+var resourceAddress = regexp.MustCompile(`^(/api/[^/]+)?/(lights|groups|scenes|sensors|rules|schedules|resourcelinks)/([^/]+)(.*)$`)
+
+// Backup contains all resources of a bridge reachable through the API.
+// All resources are keyed by their ID on the backed up bridge.
+type Backup struct {
+	Version       int                        `json:"version"`
+	Created       time.Time                  `json:"created"`
+	BridgeId      string                     `json:"bridgeid"`
+	APIVersion    string                     `json:"apiversion"`
+	Lights        map[string]LightAttributes `json:"lights"`
+	Groups        map[string]Group           `json:"groups"`
+	Scenes        map[string]StoredScene     `json:"scenes"`
+	Sensors       map[string]Sensor          `json:"sensors"`
+	Rules         map[string]Rule            `json:"rules"`
+	Schedules     map[string]Schedule        `json:"schedules"`
+	ResourceLinks map[string]ResourceLink    `json:"resourcelinks"`
+}
+
+// RestoreReport describes the outcome of restoring a backup.
+type RestoreReport struct {
+	// Mapping contains the new address of every restored resource
+	// keyed by its address in the backup, e.g. /lights/3 -> /lights/7.
+	Mapping map[string]string
+	// Errors contains all resources which couldn't be restored.
+	Errors []error
+}
+
+// Backup reads all resources from the bridge.
+func (bridge *Bridge) Backup() (*Backup, error) {
+	config, err := bridge.Configuration()
+	if err != nil {
+		return nil, err
+	}
+	backup := Backup{
+		Version:    backupVersion,
+		Created:    time.Now().UTC(),
+		BridgeId:   config.BridgeId,
+		APIVersion: config.APIVersion,
+		Scenes:     make(map[string]StoredScene),
+	}
+
+	resources := map[string]interface{}{
+		"/lights":        &backup.Lights,
+		"/groups":        &backup.Groups,
+		"/sensors":       &backup.Sensors,
+		"/rules":         &backup.Rules,
+		"/schedules":     &backup.Schedules,
+		"/resourcelinks": &backup.ResourceLinks,
+	}
+	for path, result := range resources {
+		err = bridge.get(path, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Light states are only returned for single scenes
+	scenes, err := bridge.AllScenes()
+	if err != nil {
+		return nil, err
+	}
+	for _, scene := range scenes {
+		stored, err := bridge.storedSceneByID(scene.Id)
+		if err != nil {
+			return nil, err
+		}
+		backup.Scenes[scene.Id] = *stored
+	}
+
+	return &backup, nil
+}
+
+// ReadBackup decodes a backup written by Backup.Write.
+func ReadBackup(r io.Reader) (*Backup, error) {
+	var backup Backup
+	err := json.NewDecoder(r).Decode(&backup)
+	if err != nil {
+		return nil, err
+	}
+	if backup.Version != backupVersion {
+		return nil, fmt.Errorf("Unsupported backup version %d", backup.Version)
+	}
+	return &backup, nil
+}
+
+// Write encodes the backup as JSON document.
+func (backup *Backup) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(backup)
+}
+
+// Restore recreates all resources of the backup on the bridge, which should
+// be factory new. Lights and physical sensors can't be created, so they are
+// matched by their unique id and only renamed and reconfigured.
+// All references between resources (e.g. rule actions addressing /groups/3)
+// are adjusted to the IDs on the bridge. Resources which fail to restore are
+// listed in the report and don't abort the restore.
+func (bridge *Bridge) Restore(backup *Backup) (*RestoreReport, error) {
+	r := restorer{bridge: bridge, backup: backup, report: &RestoreReport{Mapping: make(map[string]string)}}
+
+	steps := []func() error{r.lights, r.groups, r.sensors, r.scenes, r.schedules, r.rules, r.resourceLinks}
+	for _, step := range steps {
+		err := step()
+		if err != nil {
+			return r.report, err
+		}
+	}
+	return r.report, nil
+}
+
+type restorer struct {
+	bridge *Bridge
+	backup *Backup
+	report *RestoreReport
+}
+
+func (r *restorer) lights() error {
+	lights, err := r.bridge.GetAllLights()
+	if err != nil {
+		return err
+	}
+	byUniqueID := make(map[string]*Light)
+	for _, light := range lights {
+		byUniqueID[light.Attributes.UniqueId] = light
+	}
+
+	for _, id := range sortedIDs(r.backup.Lights) {
+		attributes := r.backup.Lights[id]
+		light, ok := byUniqueID[attributes.UniqueId]
+		if !ok {
+			r.fail("/lights/"+id, fmt.Errorf("no light with unique id %s", attributes.UniqueId))
+			continue
+		}
+		r.mapID("lights", id, light.Id)
+		if light.Name != attributes.Name {
+			results, err := light.SetName(attributes.Name)
+			r.check("/lights/"+id, results, err)
+		}
+	}
+	return nil
+}
+
+func (r *restorer) groups() error {
+	existing, err := r.bridge.AllGroups()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range sortedIDs(r.backup.Groups) {
+		group := r.backup.Groups[id]
+		if group.Type == "Luminaire" || group.Type == "Lightsource" {
+			// Created by the bridge itself
+			for _, candidate := range existing {
+				if candidate.Type == group.Type && candidate.Name == group.Name {
+					r.mapID("groups", id, candidate.Id)
+				}
+			}
+			continue
+		}
+
+		results, err := r.bridge.CreateGroup(CreateGroup{
+			Name:   group.Name,
+			Type:   group.Type,
+			Class:  group.Class,
+			Lights: r.mapIDs("lights", group.Lights),
+		})
+		r.created("groups", id, results, err)
+	}
+	return nil
+}
+
+func (r *restorer) sensors() error {
+	existing, err := r.bridge.AllSensors()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range sortedIDs(r.backup.Sensors) {
+		sensor := r.backup.Sensors[id]
+		path := "/sensors/" + id
+
+		if strings.HasPrefix(sensor.Type, "CLIP") {
+			results, err := r.bridge.CreateSensor(CreateSensor{
+				Name:             sensor.Name,
+				Type:             sensor.Type,
+				ModelId:          sensor.ModelId,
+				ManufacturerName: sensor.ManufacturerName,
+				SoftwareVersion:  sensor.SoftwareVersion,
+				UniqueId:         sensor.UniqueId,
+				Recycle:          sensor.Recycle,
+				State:            withoutKeys(sensor.State, "lastupdated"),
+				Config:           writableSensorConfig(sensor.Config),
+			})
+			r.created("sensors", id, results, err)
+			continue
+		}
+
+		// Physical and built-in sensors are matched by unique id or,
+		// if they don't have one (e.g. the daylight sensor), by type.
+		var target *Sensor
+		for _, candidate := range existing {
+			if sensor.UniqueId != "" && candidate.UniqueId == sensor.UniqueId {
+				target = candidate
+				break
+			}
+			if sensor.UniqueId == "" && candidate.UniqueId == "" && candidate.Type == sensor.Type && candidate.ModelId == sensor.ModelId {
+				target = candidate
+				break
+			}
+		}
+		if target == nil {
+			r.fail(path, fmt.Errorf("no sensor with unique id %s", sensor.UniqueId))
+			continue
+		}
+		r.mapID("sensors", id, target.Id)
+
+		if target.Name != sensor.Name {
+			results, err := target.SetName(sensor.Name)
+			r.check(path, results, err)
+		}
+		if config := writableSensorConfig(sensor.Config); len(config) > 0 {
+			results, err := target.ModifyConfig(config)
+			r.check(path, results, err)
+		}
+	}
+	return nil
+}
+
+func (r *restorer) scenes() error {
+	for _, id := range sortedIDs(r.backup.Scenes) {
+		scene := r.backup.Scenes[id]
+
+		lightstates := make(map[string]ModifyLightState)
+		for lightID, lightstate := range scene.LightStates {
+			if newID, ok := r.mapped("lights", lightID); ok {
+				lightstates[newID] = lightstate
+			}
+		}
+		scenedata := CreateScene{
+			Name:        scene.Name,
+			Type:        scene.Type,
+			Recycle:     scene.Recycle,
+			Appdata:     scene.Appdata,
+			Picture:     scene.Picture,
+			LightStates: lightstates,
+		}
+		if scene.Type == GroupScene {
+			groupID, ok := r.mapped("groups", scene.Group)
+			if !ok {
+				r.fail("/scenes/"+id, fmt.Errorf("group %s wasn't restored", scene.Group))
+				continue
+			}
+			scenedata.Group = groupID
+		} else {
+			scenedata.Lights = r.mapIDs("lights", scene.Lights)
+		}
+
+		results, err := r.bridge.CreateScene(scenedata)
+		r.created("scenes", id, results, err)
+	}
+	return nil
+}
+
+func (r *restorer) schedules() error {
+	for _, id := range sortedIDs(r.backup.Schedules) {
+		schedule := r.backup.Schedules[id]
+		autodelete := schedule.AutoDelete
+
+		results, err := r.bridge.CreateSchedule(CreateSchedule{
+			Name:        schedule.Name,
+			Description: schedule.Description,
+			Command: ScheduleCommand{
+				Address: r.remapAddress(schedule.Command.Address),
+				Method:  schedule.Command.Method,
+				Body:    r.remapBody(schedule.Command.Body),
+			},
+			LocalTime:  schedule.LocalTime,
+			Status:     schedule.Status,
+			AutoDelete: &autodelete,
+			Recycle:    schedule.Recycle,
+		})
+		r.created("schedules", id, results, err)
+	}
+	return nil
+}
+
+func (r *restorer) rules() error {
+	for _, id := range sortedIDs(r.backup.Rules) {
+		rule := r.backup.Rules[id]
+
+		var conditions []RuleCondition
+		for _, condition := range rule.Conditions {
+			condition.Address = r.remapAddress(condition.Address)
+			conditions = append(conditions, condition)
+		}
+		var actions []RuleAction
+		for _, action := range rule.Actions {
+			action.Address = r.remapAddress(action.Address)
+			action.Body = r.remapBody(action.Body)
+			actions = append(actions, action)
+		}
+
+		results, err := r.bridge.CreateRule(CreateRule{
+			Name:       rule.Name,
+			Status:     rule.Status,
+			Recycle:    rule.Recycle,
+			Conditions: conditions,
+			Actions:    actions,
+		})
+		r.created("rules", id, results, err)
+	}
+	return nil
+}
+
+func (r *restorer) resourceLinks() error {
+	for _, id := range sortedIDs(r.backup.ResourceLinks) {
+		link := r.backup.ResourceLinks[id]
+
+		var links []string
+		for _, address := range link.Links {
+			links = append(links, r.remapAddress(address))
+		}
+
+		results, err := r.bridge.CreateResourceLink(CreateResourceLink{
+			Name:        link.Name,
+			Description: link.Description,
+			ClassId:     link.ClassId,
+			Recycle:     link.Recycle,
+			Links:       links,
+		})
+		r.created("resourcelinks", id, results, err)
+	}
+	return nil
+}
+
+func (r *restorer) mapID(kind, oldID, newID string) {
+	r.report.Mapping[fmt.Sprintf("/%s/%s", kind, oldID)] = fmt.Sprintf("/%s/%s", kind, newID)
+}
+
+// mapped returns the new ID of the given resource.
+func (r *restorer) mapped(kind, oldID string) (string, bool) {
+	if kind == "groups" && oldID == "0" {
+		return oldID, true
+	}
+	path, ok := r.report.Mapping[fmt.Sprintf("/%s/%s", kind, oldID)]
+	if !ok {
+		return "", false
+	}
+	return strings.TrimPrefix(path, "/"+kind+"/"), true
+}
+
+// mapIDs returns the new IDs of all given resources, dropping unmapped ones.
+func (r *restorer) mapIDs(kind string, oldIDs []string) []string {
+	newIDs := []string{}
+	for _, oldID := range oldIDs {
+		if newID, ok := r.mapped(kind, oldID); ok {
+			newIDs = append(newIDs, newID)
+		}
+	}
+	return newIDs
+}
+
+// remapAddress replaces the resource ID in the given address with its new ID.
+// The username of schedule commands is replaced with the current username.
+func (r *restorer) remapAddress(address string) string {
+	match := resourceAddress.FindStringSubmatch(address)
+	if match == nil {
+		return address
+	}
+
+	prefix := match[1]
+	if prefix != "" {
+		prefix = "/api/" + r.bridge.Username
+	}
+	newID, ok := r.mapped(match[2], match[3])
+	if !ok {
+		r.fail(address, fmt.Errorf("referenced resource wasn't restored"))
+		newID = match[3]
+	}
+	return fmt.Sprintf("%s/%s/%s%s", prefix, match[2], newID, match[4])
+}
+
+// remapBody replaces scene references in a request body.
+func (r *restorer) remapBody(body map[string]interface{}) map[string]interface{} {
+	sceneID, ok := body["scene"].(string)
+	if !ok {
+		return body
+	}
+	remapped := withoutKeys(body)
+	if newID, ok := r.mapped("scenes", sceneID); ok {
+		remapped["scene"] = newID
+	} else {
+		r.fail("/scenes/"+sceneID, fmt.Errorf("referenced scene wasn't restored"))
+	}
+	return remapped
+}
+
+// created records the new ID of a restored resource.
+func (r *restorer) created(kind, oldID string, results []Result, err error) {
+	path := fmt.Sprintf("/%s/%s", kind, oldID)
+	if err != nil {
+		r.fail(path, err)
+		return
+	}
+	newID, err := createdID(results)
+	if err != nil {
+		r.fail(path, err)
+		return
+	}
+	r.mapID(kind, oldID, newID)
+}
+
+func (r *restorer) check(path string, results []Result, err error) {
+	if err == nil {
+		err = resultsError(results)
+	}
+	if err != nil {
+		r.fail(path, err)
+	}
+}
+
+func (r *restorer) fail(path string, err error) {
+	r.report.Errors = append(r.report.Errors, fmt.Errorf("%s: %v", path, err))
+}
+
+// writableSensorConfig removes all read-only attributes from the given sensor configuration.
+func writableSensorConfig(config map[string]interface{}) map[string]interface{} {
+	return withoutKeys(config, "reachable", "battery", "pending", "configured", "sensitivitymax", "lat", "long")
+}
+
+// withoutKeys returns a copy of the given map without the given keys.
+func withoutKeys(m map[string]interface{}, keys ...string) map[string]interface{} {
+	result := make(map[string]interface{})
+	for key, value := range m {
+		result[key] = value
+	}
+	for _, key := range keys {
+		delete(result, key)
+	}
+	return result
+}
+
+// sortedIDs returns the keys of the given resource map in numerical order,
+// so resources are restored in the order they were created.
+func sortedIDs(resources interface{}) []string {
+	var ids []string
+	for _, key := range reflect.ValueOf(resources).MapKeys() {
+		ids = append(ids, key.String())
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, errA := strconv.Atoi(ids[i])
+		b, errB := strconv.Atoi(ids[j])
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
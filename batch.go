@@ -0,0 +1,259 @@
+package hue
+
+import (
+	"log/slog"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Number of requests sent one after another to apply a batch through a group
+// action (look up groups and lights, set the group state) or a temporary scene
+// (check the capacity, create, recall and delete the scene).
+const (
+	batchGroupRequests = 3
+	batchSceneRequests = 4
+)
+
+// Maximum number of light requests a batch issues in parallel.
+const batchConcurrency = 4
+
+// StateBatch collects state updates for several lights and sends them to
+// the bridge using as few requests as possible. Repeated updates of the same
+// light are merged before anything is sent, so only the resulting state of
+// each light reaches the bridge.
+type StateBatch struct {
+	bridge *Bridge
+	lock   sync.Mutex
+	states map[string]SetLightState
+}
+
+// NewStateBatch returns an empty batch for the bridge.
+func (bridge *Bridge) NewStateBatch() *StateBatch {
+	return &StateBatch{bridge: bridge, states: make(map[string]SetLightState)}
+}
+
+// ApplyStates sets the state of all given lights (keyed by light ID) using
+// the cheapest strategy available. See StateBatch.Apply for details.
+func (bridge *Bridge) ApplyStates(states map[string]SetLightState) ([]Result, error) {
+	batch := bridge.NewStateBatch()
+	for lightID, state := range states {
+		batch.Set(lightID, state)
+	}
+	return batch.Apply()
+}
+
+// Set queues a state update for the given light. If the light already has a
+// pending update, all attributes set in state override the queued ones.
+func (batch *StateBatch) Set(lightID string, state SetLightState) {
+	batch.lock.Lock()
+	defer batch.lock.Unlock()
+
+	if queued, ok := batch.states[lightID]; ok {
+		state = queued.merge(state)
+	}
+	batch.states[lightID] = state
+}
+
+// Len returns the number of lights with pending updates.
+func (batch *StateBatch) Len() int {
+	batch.lock.Lock()
+	defer batch.lock.Unlock()
+
+	return len(batch.states)
+}
+
+// Apply sends all pending updates to the bridge and clears the batch.
+// Updates are sent with parallel light requests unless another strategy
+// needs fewer requests in a row: a single group action is used if all lights
+// share the same state and a group with exactly these lights exists. Otherwise
+// the states are stored in a temporary scene which is recalled and deleted
+// afterwards. If the scene can't be created (e.g. the bridge is full), the
+// light requests are used nevertheless.
+func (batch *StateBatch) Apply() ([]Result, error) {
+	batch.lock.Lock()
+	states := batch.states
+	batch.states = make(map[string]SetLightState)
+	batch.lock.Unlock()
+
+	if len(states) == 0 {
+		return nil, nil
+	}
+	if len(states) == 1 {
+		return batch.applyPerLight(states)
+	}
+
+	lightIDs := make([]string, 0, len(states))
+	for lightID := range states {
+		lightIDs = append(lightIDs, lightID)
+	}
+	sort.Strings(lightIDs)
+
+	perLight := batch.perLightRequests(len(states))
+	if perLight > batchGroupRequests {
+		if state, uniform := uniformState(states); uniform {
+			group, err := batch.groupWithLights(lightIDs)
+			if err == nil && group != nil {
+				return group.SetState(state)
+			}
+		}
+	}
+	if perLight > batchSceneRequests && sceneCompatible(states) {
+		scene, err := batch.createScene(lightIDs, states)
+		if err == nil {
+			return batch.recallScene(scene)
+		}
+		batch.bridge.log(slog.LevelDebug, "Unable to create scene for batch", "error", err)
+	}
+
+	return batch.applyPerLight(states)
+}
+
+// perLightRequests returns the number of requests in a row needed to send
+// the given number of light requests.
+func (batch *StateBatch) perLightRequests(lights int) int {
+	batch.bridge.lock.Lock()
+	rateLimited := batch.bridge.delayBetweenRequests > 0
+	batch.bridge.lock.Unlock()
+
+	if rateLimited {
+		return lights // starts are spaced by the delay
+	}
+	return (lights + batchConcurrency - 1) / batchConcurrency
+}
+
+// groupWithLights looks for a group containing exactly the given lights.
+// It returns nil if no such group exists.
+func (batch *StateBatch) groupWithLights(lightIDs []string) (*Group, error) {
+	groups, err := batch.bridge.AllGroups()
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if sameLights(group.Lights, lightIDs) {
+			return group, nil
+		}
+	}
+
+	// Group 0 is not listed but contains all lights
+	lights, err := batch.bridge.GetAllLights()
+	if err != nil {
+		return nil, err
+	}
+	var allLights []string
+	for _, light := range lights {
+		allLights = append(allLights, light.Id)
+	}
+	if sameLights(allLights, lightIDs) {
+		return &Group{bridge: batch.bridge, Id: "0", Lights: allLights}, nil
+	}
+	return nil, nil
+}
+
+// createScene stores the states in a temporary scene.
+func (batch *StateBatch) createScene(lightIDs []string, states map[string]SetLightState) (*Scene, error) {
+	lightstates := make(map[string]ModifyLightState)
+	for lightID, state := range states {
+		lightstates[lightID] = state.sceneState()
+	}
+	scenedata := CreateScene{
+		Name:        "go.hue batch",
+		Type:        LightScene,
+		Lights:      lightIDs,
+		Recycle:     true,
+		LightStates: lightstates,
+	}
+
+	results, err := batch.bridge.CreateScene(scenedata)
+	if err != nil {
+		return nil, err
+	}
+	sceneID, err := createdID(results)
+	if err != nil {
+		return nil, err
+	}
+	return &Scene{bridge: batch.bridge, Id: sceneID}, nil
+}
+
+// recallScene activates the temporary scene and deletes it afterwards.
+func (batch *StateBatch) recallScene(scene *Scene) ([]Result, error) {
+	results, err := scene.Activate()
+	deleted, deleteErr := scene.Delete()
+	results = append(results, deleted...)
+	if err != nil {
+		return results, err
+	}
+	return results, deleteErr
+}
+
+func (batch *StateBatch) applyPerLight(states map[string]SetLightState) ([]Result, error) {
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var results []Result
+	var firstErr error
+
+	slots := make(chan struct{}, batchConcurrency)
+	for lightID, state := range states {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(lightID string, state SetLightState) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			// The only requests which don't wait for each other
+			params := state.params()
+			var result []Result
+			err := batch.bridge.call(&Call{Method: "PUT", Path: "/lights/" + lightID + "/state", Request: &params, Result: &result, parallel: true})
+			lock.Lock()
+			defer lock.Unlock()
+			results = append(results, result...)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(lightID, state)
+	}
+	wg.Wait()
+
+	return results, firstErr
+}
+
+// uniformState reports whether all given states are identical.
+func uniformState(states map[string]SetLightState) (SetLightState, bool) {
+	var first *SetLightState
+	for _, state := range states {
+		state := state
+		if first == nil {
+			first = &state
+			continue
+		}
+		if !reflect.DeepEqual(*first, state) {
+			return SetLightState{}, false
+		}
+	}
+	return *first, true
+}
+
+// sceneCompatible reports whether all given states can be stored in a scene.
+// Scenes can't store alert effects.
+func sceneCompatible(states map[string]SetLightState) bool {
+	for _, state := range states {
+		if state.Alert != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func sameLights(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sorted := append([]string(nil), a...)
+	sort.Strings(sorted)
+	for i := range sorted {
+		if sorted[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -2,12 +2,13 @@ package hue
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"sync"
 	"time"
@@ -17,58 +18,194 @@ import (
 type Bridge struct {
 	IpAddr               string
 	Username             string
-	debug                bool
+	clientKey            string
+	logger               Logger
+	requestID            uint64
+	interceptors         []Interceptor
 	useHTTPS             bool
+	autoHTTPS            bool
+	negotiated           bool
+	negotiationFailed    time.Time
+	negotiateLock        *sync.Mutex
+	apiVersion           *Version
+	bridgeID             string
+	capacity             map[string]ResourceCapacity
+	onAddressChange      func(AddressChange)
+	rediscoverLock       *sync.Mutex
+	lastRediscovery      rediscoveryOutcome
 	delayBetweenRequests time.Duration
 	lastRequestTimestamp time.Time
 	lock                 *sync.Mutex
+	requestLock          *sync.Mutex
 	client               *http.Client
 }
 
+// Error type reported by the bridge if the link button wasn't pressed.
+const errorLinkButtonNotPressed = 101
+
+// ErrLinkButtonNotPressed is returned by CreateUser until the link button
+// on the bridge was pressed.
+var ErrLinkButtonNotPressed = errors.New("Link button not pressed")
+
 // CreateUser registers a new user on the bridge. The user will have
 // to authenticate this request by pressing the blue link button
 // on the physical bridge.
 func (bridge *Bridge) CreateUser(deviceType string) error {
-	params := map[string]string{"devicetype": deviceType}
-	var results []map[string]map[string]string
+	_, err := bridge.createUser(deviceType, false)
+	return err
+}
 
+// CreateUserWithClientKey registers a new user like CreateUser and
+// additionally returns the client key used by the entertainment API.
+func (bridge *Bridge) CreateUserWithClientKey(deviceType string) (string, error) {
+	return bridge.createUser(deviceType, true)
+}
+
+func (bridge *Bridge) createUser(deviceType string, generateClientKey bool) (string, error) {
+	params := map[string]interface{}{"devicetype": deviceType}
+	if generateClientKey {
+		params["generateclientkey"] = true
+	}
+	var results []Result
+
+	bridge.negotiate()
 	err := bridge.do("POST", bridge.baseURL(), &params, &results)
 	if err != nil {
-		return err
+		return "", err
+	}
+	if len(results) == 0 {
+		return "", errors.New("Bridge returned no result")
+	}
+	if resultErr := results[0].Error; resultErr != nil {
+		if resultErr.Type == errorLinkButtonNotPressed {
+			return "", ErrLinkButtonNotPressed
+		}
+		return "", resultErr
 	}
 
 	bridge.lock.Lock()
 	defer bridge.lock.Unlock()
 
-	value := results[0]
-	bridge.Username = value["success"]["username"]
-	return nil
+	bridge.Username = fmt.Sprint(results[0].Success["username"])
+	if clientKey, ok := results[0].Success["clientkey"]; ok {
+		bridge.clientKey = fmt.Sprint(clientKey)
+	}
+	return bridge.clientKey, nil
+}
+
+// ClientKey returns the client key created by CreateUserWithClientKey or
+// loaded from a CredentialStore.
+func (bridge *Bridge) ClientKey() string {
+	bridge.lock.Lock()
+	defer bridge.lock.Unlock()
+
+	return bridge.clientKey
 }
 
 // NewBridge instantiates a bridge object. Use this method when you already
-// know the ip address and username to use.
+// know the ip address and username to use. The address may contain a port
+// (e.g. 192.168.1.2:8080) and can be an IPv6 address (with a port it has
+// to be enclosed in brackets, e.g. [fe80::1%eth0]:8080).
 func NewBridge(ipAddr, username string) *Bridge {
-	return &Bridge{IpAddr: ipAddr, Username: username, debug: false, useHTTPS: false, delayBetweenRequests: 0, client: newTimeoutClient(), lock: &sync.Mutex{}}
+	return &Bridge{IpAddr: ipAddr, Username: username, useHTTPS: false, delayBetweenRequests: 0, client: newTimeoutClient(), lock: &sync.Mutex{}, requestLock: &sync.Mutex{}, rediscoverLock: &sync.Mutex{}, negotiateLock: &sync.Mutex{}}
 }
 
-// Debug enables the output of debug messages for every bridge request.
+// Debug enables the output of debug messages for every bridge request
+// using the standard logger. Use SetLogger for structured logging.
 func (bridge *Bridge) Debug() *Bridge {
-	bridge.lock.Lock()
-	defer bridge.lock.Unlock()
-
-	bridge.debug = true
+	bridge.SetLogger(stdLogger{})
 	return bridge
 }
 
-// EnableHTTPS controls the use of an encrypted communication (requires bridge software version 1.24 or later)
+// EnableHTTPS controls the use of an encrypted communication (requires bridge API version 1.24 or later,
+// see SupportsAPI). This disables the automatic negotiation enabled by EnableAutoHTTPS.
 func (bridge *Bridge) EnableHTTPS(enable bool) {
 	bridge.lock.Lock()
 	defer bridge.lock.Unlock()
 
 	bridge.useHTTPS = enable
+	bridge.autoHTTPS = false
+}
+
+// EnableAutoHTTPS lets the bridge decide on the use of an encrypted communication.
+// Before the first request the API version is read from the (unauthenticated)
+// configuration. HTTPS is used if the bridge supports it and a HTTPS connection
+// can be established, otherwise the communication falls back to HTTP.
+// Use UsingHTTPS to find out which mode is active.
+func (bridge *Bridge) EnableAutoHTTPS() {
+	bridge.lock.Lock()
+	defer bridge.lock.Unlock()
+
+	bridge.autoHTTPS = true
+	bridge.negotiated = false
+	bridge.negotiationFailed = time.Time{}
+}
+
+// UsingHTTPS reports whether the communication with the bridge is encrypted.
+func (bridge *Bridge) UsingHTTPS() bool {
+	bridge.lock.Lock()
+	defer bridge.lock.Unlock()
+
+	return bridge.useHTTPS
+}
+
+// Time after which a negotiation failed because of an unreachable bridge is repeated.
+const negotiationRetryInterval = time.Minute
+
+// negotiate selects HTTPS or HTTP if automatic negotiation is enabled and
+// hasn't completed yet. Concurrent callers wait for a single negotiation.
+// If the bridge can't be reached, the current mode is kept and the negotiation
+// is repeated after negotiationRetryInterval or once the address changed.
+func (bridge *Bridge) negotiate() {
+	if !bridge.negotiationPending() {
+		return
+	}
+	bridge.negotiateLock.Lock()
+	defer bridge.negotiateLock.Unlock()
+	if !bridge.negotiationPending() {
+		return // negotiated by another caller in the meantime
+	}
+
+	ipAddr := bridge.address()
+	var config Configuration
+	err := bridge.do("GET", hostURL("http", ipAddr, "/api/config"), nil, &config)
+	if err != nil {
+		bridge.lock.Lock()
+		bridge.negotiationFailed = time.Now()
+		bridge.lock.Unlock()
+		return
+	}
+	version, err := config.ParsedAPIVersion()
+	useHTTPS := err == nil && version.AtLeast(Version{Major: 1, Minor: 24})
+	if useHTTPS {
+		// Make sure HTTPS actually works before switching
+		var secureConfig Configuration
+		useHTTPS = bridge.do("GET", hostURL("https", ipAddr, "/api/config"), nil, &secureConfig) == nil
+	}
+
+	bridge.lock.Lock()
+	defer bridge.lock.Unlock()
+	if !bridge.autoHTTPS {
+		return // disabled in the meantime
+	}
+	bridge.useHTTPS = useHTTPS
+	bridge.negotiated = true
+	if err == nil {
+		bridge.apiVersion = &version
+	}
+}
+
+// negotiationPending reports whether negotiate has to contact the bridge.
+func (bridge *Bridge) negotiationPending() bool {
+	bridge.lock.Lock()
+	defer bridge.lock.Unlock()
+
+	return bridge.autoHTTPS && !bridge.negotiated && time.Since(bridge.negotiationFailed) >= negotiationRetryInterval
 }
 
 // EnableRateLimiting will only allow requests in the rate of the given paramter duration. If requests are issued faster, the function will wait for the specified time and execute the request afterwards.
+// Requests are executed one after another, so the delay is measured from the end of a request to the start of the next one.
+// Only the per light updates of a StateBatch run in parallel, their starts are spaced by the given delay.
 func (bridge *Bridge) EnableRateLimiting(delayBetweenRequests time.Duration) {
 	bridge.lock.Lock()
 	defer bridge.lock.Unlock()
@@ -77,10 +214,23 @@ func (bridge *Bridge) EnableRateLimiting(delayBetweenRequests time.Duration) {
 }
 
 func (bridge *Bridge) baseURL() string {
-	if bridge.useHTTPS {
-		return fmt.Sprintf("https://%s/api", bridge.IpAddr)
+	bridge.lock.Lock()
+	useHTTPS := bridge.useHTTPS
+	ipAddr := bridge.IpAddr
+	bridge.lock.Unlock()
+
+	if useHTTPS {
+		return hostURL("https", ipAddr, "/api")
 	}
-	return fmt.Sprintf("http://%s/api", bridge.IpAddr)
+	return hostURL("http", ipAddr, "/api")
+}
+
+// address returns the current address of the bridge.
+func (bridge *Bridge) address() string {
+	bridge.lock.Lock()
+	defer bridge.lock.Unlock()
+
+	return bridge.IpAddr
 }
 
 func (bridge *Bridge) toURI(path string) string {
@@ -91,36 +241,83 @@ func (bridge *Bridge) toURI(path string) string {
 }
 
 func (bridge *Bridge) get(path string, result interface{}) error {
-	return bridge.do("GET", bridge.toURI(path), nil, result)
+	return bridge.request("GET", path, nil, result)
 }
 
 func (bridge *Bridge) post(path string, request interface{}, result interface{}) error {
-	return bridge.do("POST", bridge.toURI(path), request, result)
+	return bridge.request("POST", path, request, result)
 }
 
 func (bridge *Bridge) put(path string, request interface{}, result interface{}) error {
-	return bridge.do("PUT", bridge.toURI(path), request, result)
+	return bridge.request("PUT", path, request, result)
 }
 
 func (bridge *Bridge) delete(path string, result interface{}) error {
-	return bridge.do("DELETE", bridge.toURI(path), nil, result)
+	return bridge.request("DELETE", path, nil, result)
 }
 
-func (bridge *Bridge) do(method string, url string, request interface{}, result interface{}) error {
+// request executes a request on the given API path.
+func (bridge *Bridge) request(method string, path string, request interface{}, result interface{}) error {
+	return bridge.call(&Call{Method: method, Path: path, Request: request, Result: result})
+}
+
+// call executes the given call through all interceptors added with Use.
+func (bridge *Bridge) call(call *Call) error {
 	bridge.lock.Lock()
-	defer bridge.lock.Unlock()
+	interceptors := bridge.interceptors
+	bridge.lock.Unlock()
+
+	return chain(interceptors, bridge.invoke)(call)
+}
 
-	if bridge.delayBetweenRequests > 0 {
+// invoke executes a call. If no connection to the bridge can be established
+// and rediscovery is enabled, the call is retried once the bridge was found at
+// a new address.
+func (bridge *Bridge) invoke(call *Call) error {
+	start := time.Now()
+	defer func() { call.Latency = time.Since(start) }()
+
+	ipAddr := bridge.address()
+	bridge.negotiate()
+	err := bridge.send(call.parallel, call.Method, bridge.toURI(call.Path), call.Request, call.Result)
+	if err == nil || !isDialError(err) {
+		return err
+	}
+	if bridge.rediscover(ipAddr, start) != nil {
+		return err
+	}
+	bridge.negotiate()
+	return bridge.send(call.parallel, call.Method, bridge.toURI(call.Path), call.Request, call.Result)
+}
+
+func (bridge *Bridge) do(method string, url string, request interface{}, result interface{}) error {
+	return bridge.send(false, method, url, request, result)
+}
+
+// send executes a single request. Requests wait for each other unless
+// parallel is set, which is only used for the updates of a StateBatch.
+func (bridge *Bridge) send(parallel bool, method string, url string, request interface{}, result interface{}) error {
+	if !parallel {
+		bridge.requestLock.Lock()
+		defer bridge.requestLock.Unlock()
+	}
+
+	bridge.lock.Lock()
+	logger := bridge.logger
+	redact := bridge.redactor()
+	bridge.requestID++
+	requestID := bridge.requestID
+	waitTime := bridge.reserveRequestSlot()
+	bridge.lock.Unlock()
+
+	ctx := context.Background()
+	logURL := redact(url)
+	if waitTime > 0 {
 		// Enforce rate limit
-		now := time.Now()
-		nextRequest := bridge.lastRequestTimestamp.Add(bridge.delayBetweenRequests)
-		if now.Before(nextRequest) {
-			waitTime := time.Until(nextRequest)
-			if bridge.debug {
-				log.Printf("RATE LIMIT: Waiting %s until executing the next request", waitTime)
-			}
-			time.Sleep(waitTime)
+		if logger != nil {
+			logger.Log(ctx, slog.LevelDebug, "Rate limit delays request", "request_id", requestID, "wait", waitTime)
 		}
+		time.Sleep(waitTime)
 	}
 
 	// Marshal request struct to JSON
@@ -128,7 +325,8 @@ func (bridge *Bridge) do(method string, url string, request interface{}, result
 	var requestData []byte
 
 	if request != nil {
-		requestData, err := json.Marshal(request)
+		var err error
+		requestData, err = json.Marshal(request)
 		if err != nil {
 			return err
 		}
@@ -143,33 +341,44 @@ func (bridge *Bridge) do(method string, url string, request interface{}, result
 	httpRequest.Header.Set("Content-Type", "application/json")
 
 	// Execute request
-	if bridge.debug {
-		log.Printf("[%s] Request to %s (Body: %s)\n", method, url, requestData)
+	if logger != nil {
+		logger.Log(ctx, slog.LevelDebug, "Request", "request_id", requestID, "method", method, "url", logURL, "body", redact(string(requestData)))
 	}
 
+	start := time.Now()
 	httpResponse, err := bridge.client.Do(httpRequest)
-	bridge.lastRequestTimestamp = time.Now()
+	bridge.finishRequest()
 	if httpResponse != nil {
 		defer httpResponse.Body.Close()
 		defer io.Copy(ioutil.Discard, httpResponse.Body)
 	}
 	if err != nil {
+		if logger != nil {
+			logger.Log(ctx, slog.LevelWarn, "Request failed", "request_id", requestID, "method", method, "url", logURL, "duration", time.Since(start), "error", redact(err.Error()))
+		}
 		return err
 	}
 
 	// Decode response JSON to struct
+	var responseData []byte
+	if result != nil {
+		responseData, err = ioutil.ReadAll(httpResponse.Body)
+	}
+	if logger != nil {
+		logger.Log(ctx, slog.LevelDebug, "Response", "request_id", requestID, "method", method, "url", logURL, "status", httpResponse.StatusCode, "duration", time.Since(start), "body", redact(string(responseData)))
+	}
+	if err != nil {
+		return err
+	}
 	if result != nil {
-		responseData, err := ioutil.ReadAll(httpResponse.Body)
-		if err != nil {
-			return err
-		}
-
-		if bridge.debug {
-			log.Printf("[%s] Response to %s (Body: %s)\n", method, url, responseData)
-		}
-
 		err = json.Unmarshal(responseData, result)
 		if err != nil {
+			// The bridge answers with an error result (e.g. for unknown IDs)
+			// whatever result was expected
+			var results []Result
+			if json.Unmarshal(responseData, &results) == nil && resultsError(results) != nil {
+				return resultsError(results)
+			}
 			return err
 		}
 	}
@@ -177,10 +386,40 @@ func (bridge *Bridge) do(method string, url string, request interface{}, result
 	return nil
 }
 
+// reserveRequestSlot claims the next free request slot according to the
+// configured rate limit and returns how long the caller has to wait for it.
+// The lock must be held by the caller.
+func (bridge *Bridge) reserveRequestSlot() time.Duration {
+	now := time.Now()
+	if bridge.delayBetweenRequests <= 0 {
+		bridge.lastRequestTimestamp = now
+		return 0
+	}
+
+	nextRequest := bridge.lastRequestTimestamp.Add(bridge.delayBetweenRequests)
+	if nextRequest.Before(now) {
+		nextRequest = now
+	}
+	bridge.lastRequestTimestamp = nextRequest
+	return nextRequest.Sub(now)
+}
+
+// finishRequest starts the rate limit delay for the next request once the
+// bridge answered.
+func (bridge *Bridge) finishRequest() {
+	bridge.lock.Lock()
+	defer bridge.lock.Unlock()
+
+	if now := time.Now(); now.After(bridge.lastRequestTimestamp) {
+		bridge.lastRequestTimestamp = now
+	}
+}
+
 // GetNewLights retrieves the list lights we've seen since
 // the last scan. Returns the new lights, lastseen and any error
 // that may have occurred as per:
 // http://developers.meethue.com/1_lightsapi.html#12_get_new_lights
+// Use ParseLastScan to convert lastscan into a time.
 func (bridge *Bridge) GetNewLights() ([]*Light, string, error) {
 	results := make(map[string]interface{})
 	err := bridge.get("/lights/new", &results)
@@ -0,0 +1,174 @@
+package hue
+
+import "fmt"
+
+// Capabilities describes how many resources the bridge can store
+// (requires bridge API version 1.15 or later).
+type Capabilities struct {
+	Lights        ResourceCapacity `json:"lights"`
+	Sensors       SensorCapacity   `json:"sensors"`
+	Groups        ResourceCapacity `json:"groups"`
+	Scenes        SceneCapacity    `json:"scenes"`
+	Schedules     ResourceCapacity `json:"schedules"`
+	Rules         RuleCapacity     `json:"rules"`
+	ResourceLinks ResourceCapacity `json:"resourcelinks"`
+	Timezones     struct {
+		Values []string `json:"values"`
+	} `json:"timezones"`
+}
+
+// ResourceCapacity contains the total and remaining number of resources the bridge can store.
+type ResourceCapacity struct {
+	Available int `json:"available"`
+	Total     int `json:"total"`
+}
+
+// SensorCapacity contains the capacity for all sensors and per sensor protocol.
+type SensorCapacity struct {
+	ResourceCapacity
+	Clip ResourceCapacity `json:"clip"`
+	ZLL  ResourceCapacity `json:"zll"`
+	ZGP  ResourceCapacity `json:"zgp"`
+}
+
+// SceneCapacity contains the capacity for scenes and the light states stored in all scenes.
+type SceneCapacity struct {
+	ResourceCapacity
+	LightStates ResourceCapacity `json:"lightstates"`
+}
+
+// RuleCapacity contains the capacity for rules and the conditions and actions of all rules.
+type RuleCapacity struct {
+	ResourceCapacity
+	Conditions ResourceCapacity `json:"conditions"`
+	Actions    ResourceCapacity `json:"actions"`
+}
+
+// ResourceUsage describes how many resources of a kind are stored on the bridge.
+type ResourceUsage struct {
+	Resource string
+	Used     int
+	Total    int
+}
+
+// CapacityError is returned when a resource can't be created because the
+// bridge reached its capacity.
+type CapacityError struct {
+	Resource  string
+	Requested int
+	Available int
+	Total     int
+}
+
+func (err *CapacityError) Error() string {
+	return fmt.Sprintf("Bridge is full: %d %s requested but only %d of %d available", err.Requested, err.Resource, err.Available, err.Total)
+}
+
+// Capabilities returns the resource capacity of the bridge.
+func (bridge *Bridge) Capabilities() (*Capabilities, error) {
+	var result Capabilities
+	err := bridge.get("/capabilities", &result)
+	if err != nil {
+		return nil, err
+	}
+
+	capacity := make(map[string]ResourceCapacity)
+	for _, c := range result.capacities() {
+		capacity[c.resource] = c.capacity
+	}
+	bridge.lock.Lock()
+	bridge.capacity = capacity
+	bridge.lock.Unlock()
+
+	return &result, nil
+}
+
+// Usage returns how many resources of each kind are stored on the bridge.
+func (bridge *Bridge) Usage() ([]ResourceUsage, error) {
+	capabilities, err := bridge.Capabilities()
+	if err != nil {
+		return nil, err
+	}
+
+	var usage []ResourceUsage
+	for _, c := range capabilities.capacities() {
+		usage = append(usage, ResourceUsage{Resource: c.resource, Used: c.capacity.Total - c.capacity.Available, Total: c.capacity.Total})
+	}
+	return usage, nil
+}
+
+// checkCapacity verifies the bridge can store the requested number of resources
+// for each kind. The capabilities are fetched once and updated locally for every
+// create, they are only fetched again if the bridge seems to be full. The check
+// is skipped for bridges which don't report their capabilities.
+func (bridge *Bridge) checkCapacity(requested map[string]int) error {
+	bridge.lock.Lock()
+	cached := bridge.capacity != nil
+	bridge.lock.Unlock()
+
+	if !cached {
+		_, err := bridge.Capabilities()
+		if err != nil {
+			if _, ok := err.(*ResultError); ok {
+				bridge.lock.Lock()
+				bridge.capacity = map[string]ResourceCapacity{} // not supported by the bridge
+				bridge.lock.Unlock()
+			}
+			return nil
+		}
+	}
+
+	err := bridge.reserveCapacity(requested)
+	if err != nil && cached {
+		// Resources might have been deleted in the meantime
+		_, fetchErr := bridge.Capabilities()
+		if fetchErr != nil {
+			return nil
+		}
+		err = bridge.reserveCapacity(requested)
+	}
+	return err
+}
+
+// reserveCapacity checks the requested resources against the cached capacity
+// and subtracts them from the available resources.
+func (bridge *Bridge) reserveCapacity(requested map[string]int) error {
+	bridge.lock.Lock()
+	defer bridge.lock.Unlock()
+
+	for _, resource := range sortedIDs(requested) {
+		count := requested[resource]
+		capacity, ok := bridge.capacity[resource]
+		if ok && capacity.Total > 0 && count > capacity.Available {
+			return &CapacityError{Resource: resource, Requested: count, Available: capacity.Available, Total: capacity.Total}
+		}
+	}
+	for resource, count := range requested {
+		capacity, ok := bridge.capacity[resource]
+		if ok {
+			capacity.Available -= count
+			bridge.capacity[resource] = capacity
+		}
+	}
+	return nil
+}
+
+type namedCapacity struct {
+	resource string
+	capacity ResourceCapacity
+}
+
+func (capabilities *Capabilities) capacities() []namedCapacity {
+	return []namedCapacity{
+		{"lights", capabilities.Lights},
+		{"sensors", capabilities.Sensors.ResourceCapacity},
+		{"groups", capabilities.Groups},
+		{"scenes", capabilities.Scenes.ResourceCapacity},
+		{"scene lightstates", capabilities.Scenes.LightStates},
+		{"schedules", capabilities.Schedules},
+		{"rules", capabilities.Rules.ResourceCapacity},
+		{"rule conditions", capabilities.Rules.Conditions},
+		{"rule actions", capabilities.Rules.Actions},
+		{"resourcelinks", capabilities.ResourceLinks},
+	}
+}
@@ -2,29 +2,85 @@ package hue
 
 // Configuration contains all basic information about the hue bridge itself.
 type Configuration struct {
-	Name             string                 `json:"name"`
-	ZigbeeChannel    int                    `json:"zigbeechannel"`
-	SoftwareUpdate   map[string]interface{} `json:"swupdate"`
-	Whitelist        map[string]interface{} `json:"whitelist"`
-	APIVersion       string                 `json:"apiversion"`
-	SoftwareVersion  string                 `json:"swversion"`
-	Proxyaddress     string                 `json:"proxyaddress"`
-	Proxyport        int                    `json:"proxyport"`
-	Linkbutton       bool                   `json:"linkbutton"`
-	IPAddress        string                 `json:"ipadress"`
-	Mac              string                 `json:"mac"`
-	Netmask          string                 `json:"netmask"`
-	Gateway          string                 `json:"gateway"`
-	DHCP             bool                   `json:"dhcp"`
-	Portalservices   bool                   `json:"bool"`
-	UTC              string                 `json:"UTC"`
-	Localtime        string                 `json:"localtime"`
-	Timezone         string                 `json:"timezone"`
-	ModelId          string                 `json:"modelid"`
-	BridgeId         string                 `json:"bridgeid"`
-	FactoryNew       bool                   `json:"factorynew"`
-	ReplacesBridgeId string                 `json:"replacesbridgeid"`
-	DatastoreVersion string                 `json:"datastoreversion"`
+	Name             string                    `json:"name"`
+	ZigbeeChannel    int                       `json:"zigbeechannel"`
+	SoftwareUpdate   map[string]interface{}    `json:"swupdate"`
+	SoftwareUpdate2  SoftwareUpdate2           `json:"swupdate2"`
+	Whitelist        map[string]WhitelistEntry `json:"whitelist"`
+	APIVersion       string                    `json:"apiversion"`
+	SoftwareVersion  string                    `json:"swversion"`
+	Proxyaddress     string                    `json:"proxyaddress"`
+	Proxyport        int                       `json:"proxyport"`
+	Linkbutton       bool                      `json:"linkbutton"`
+	IPAddress        string                    `json:"ipaddress"`
+	Mac              string                    `json:"mac"`
+	Netmask          string                    `json:"netmask"`
+	Gateway          string                    `json:"gateway"`
+	DHCP             bool                      `json:"dhcp"`
+	Portalservices   bool                      `json:"portalservices"`
+	UTC              string                    `json:"UTC"`
+	Localtime        string                    `json:"localtime"`
+	Timezone         string                    `json:"timezone"`
+	ModelId          string                    `json:"modelid"`
+	BridgeId         string                    `json:"bridgeid"`
+	FactoryNew       bool                      `json:"factorynew"`
+	ReplacesBridgeId string                    `json:"replacesbridgeid"`
+	DatastoreVersion string                    `json:"datastoreversion"`
+}
+
+// SoftwareUpdate2 contains the software update state of the bridge and all
+// connected devices (requires bridge API version 1.20 or later).
+type SoftwareUpdate2 struct {
+	CheckForUpdate bool                `json:"checkforupdate"`
+	LastChange     string              `json:"lastchange"`
+	State          string              `json:"state"`
+	Bridge         SoftwareUpdateState `json:"bridge"`
+	AutoInstall    SoftwareAutoInstall `json:"autoinstall"`
+}
+
+// SoftwareUpdateState contains the software update state of the bridge or a single device.
+type SoftwareUpdateState struct {
+	State       string `json:"state"`
+	LastInstall string `json:"lastinstall"`
+}
+
+// SoftwareAutoInstall contains the automatic update settings of the bridge.
+// UpdateTime is the local time the installation starts, e.g. T14:00:00.
+type SoftwareAutoInstall struct {
+	On         bool   `json:"on"`
+	UpdateTime string `json:"updatetime"`
+}
+
+// WhitelistEntry describes an application registered on the bridge.
+// Key is the username used by the application.
+type WhitelistEntry struct {
+	Key         string `json:"-"`
+	Name        string `json:"name"`
+	LastUseDate string `json:"last use date"`
+	CreateDate  string `json:"create date"`
+}
+
+// ModifyConfiguration contains all configuration attributes to be changed on the bridge.
+type ModifyConfiguration struct {
+	Name          string `json:"name,omitempty"`
+	Timezone      string `json:"timezone,omitempty"`
+	ZigbeeChannel int    `json:"zigbeechannel,omitempty"`
+
+	// Network settings. IPAddress, Netmask and Gateway are only used when DHCP is disabled.
+	DHCP      *bool  `json:"dhcp,omitempty"`
+	IPAddress string `json:"ipaddress,omitempty"`
+	Netmask   string `json:"netmask,omitempty"`
+	Gateway   string `json:"gateway,omitempty"`
+
+	// Proxy settings. Use "none" and 0 to disable the proxy.
+	ProxyAddress string `json:"proxyaddress,omitempty"`
+	ProxyPort    *int   `json:"proxyport,omitempty"`
+
+	// LinkButton emulates pressing the link button for 30 seconds.
+	LinkButton bool `json:"linkbutton,omitempty"`
+
+	// TouchLink starts a touchlink procedure to add nearby lights.
+	TouchLink bool `json:"touchlink,omitempty"`
 }
 
 // Configuration return all basic information about the hue bridge itself.
@@ -34,5 +90,20 @@ func (bridge *Bridge) Configuration() (*Configuration, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	for key, entry := range result.Whitelist {
+		entry.Key = key
+		result.Whitelist[key] = entry
+	}
 	return &result, nil
 }
+
+// UpdateConfiguration changes the given configuration attributes on the bridge.
+func (bridge *Bridge) UpdateConfiguration(config ModifyConfiguration) ([]Result, error) {
+	var results []Result
+	err := bridge.put("/config", &config, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
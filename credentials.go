@@ -0,0 +1,236 @@
+package hue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Interval between two pairing attempts in Connect.
+const pairingInterval = time.Second
+
+// ErrNoCredentials is returned by a CredentialStore without credentials for a bridge.
+var ErrNoCredentials = errors.New("No credentials stored for bridge")
+
+// Credentials contain everything needed to access a bridge.
+type Credentials struct {
+	BridgeID  string `json:"bridgeid"`
+	Username  string `json:"username"`
+	ClientKey string `json:"clientkey,omitempty"`
+	IPAddr    string `json:"ipaddress"`
+}
+
+// CredentialStore persists the credentials of bridges, keyed by bridge ID.
+type CredentialStore interface {
+	// Load returns the credentials of the given bridge or ErrNoCredentials.
+	Load(bridgeID string) (*Credentials, error)
+	// List returns the credentials of all bridges.
+	List() ([]Credentials, error)
+	// Save adds or replaces the credentials of a bridge.
+	Save(credentials Credentials) error
+	// Delete removes the credentials of the given bridge.
+	Delete(bridgeID string) error
+}
+
+// FileCredentialStore keeps credentials in a JSON file which is only
+// readable by the current user.
+type FileCredentialStore struct {
+	Path string
+	lock sync.Mutex
+}
+
+// NewFileCredentialStore returns a store using the given file. If path is
+// empty, go.hue/credentials.json in the user's configuration directory
+// (e.g. $XDG_CONFIG_HOME) is used.
+func NewFileCredentialStore(path string) (*FileCredentialStore, error) {
+	if path == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, "go.hue", "credentials.json")
+	}
+	return &FileCredentialStore{Path: path}, nil
+}
+
+// Load returns the credentials of the given bridge or ErrNoCredentials.
+func (store *FileCredentialStore) Load(bridgeID string) (*Credentials, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	all, err := store.read()
+	if err != nil {
+		return nil, err
+	}
+	credentials, ok := all[bridgeID]
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	return &credentials, nil
+}
+
+// List returns the credentials of all bridges ordered by bridge ID.
+func (store *FileCredentialStore) List() ([]Credentials, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	all, err := store.read()
+	if err != nil {
+		return nil, err
+	}
+	var list []Credentials
+	for _, credentials := range all {
+		list = append(list, credentials)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].BridgeID < list[j].BridgeID })
+	return list, nil
+}
+
+// Save adds or replaces the credentials of a bridge.
+func (store *FileCredentialStore) Save(credentials Credentials) error {
+	if credentials.BridgeID == "" {
+		return errors.New("Credentials without bridge ID")
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	all, err := store.read()
+	if err != nil {
+		return err
+	}
+	all[credentials.BridgeID] = credentials
+	return store.write(all)
+}
+
+// Delete removes the credentials of the given bridge.
+func (store *FileCredentialStore) Delete(bridgeID string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	all, err := store.read()
+	if err != nil {
+		return err
+	}
+	delete(all, bridgeID)
+	return store.write(all)
+}
+
+func (store *FileCredentialStore) read() (map[string]Credentials, error) {
+	all := make(map[string]Credentials)
+	data, err := ioutil.ReadFile(store.Path)
+	if os.IsNotExist(err) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &all)
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// write replaces the file atomically, so concurrent readers never see
+// partially written credentials.
+func (store *FileCredentialStore) write(all map[string]Credentials) error {
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(store.Path)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(dir, ".credentials-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	// TempFile creates the file with mode 0600
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), store.Path)
+}
+
+// Connect returns a bridge ready to use. If the store contains credentials,
+// the first bridge is used and its address is kept up to date via
+// rediscovery. Otherwise all bridges in the network are discovered and
+// paired: the first bridge whose link button is pressed before the context
+// is done is used and its credentials are saved to the store.
+func Connect(ctx context.Context, store CredentialStore, deviceType string) (*Bridge, error) {
+	list, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(list) > 0 {
+		return connectStored(store, list[0])
+	}
+
+	results, err := NewDiscoverer().Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ticker := time.NewTicker(pairingInterval)
+	defer ticker.Stop()
+	for {
+		for _, result := range results {
+			if result.BridgeID == "" {
+				continue // can't be stored
+			}
+			clientKey, err := result.Bridge.CreateUserWithClientKey(deviceType)
+			if err != nil {
+				continue // link button not pressed or bridge not reachable
+			}
+
+			credentials := Credentials{
+				BridgeID:  result.BridgeID,
+				Username:  result.Bridge.Username,
+				ClientKey: clientKey,
+				IPAddr:    result.Bridge.IpAddr,
+			}
+			err = store.Save(credentials)
+			if err != nil {
+				return nil, err
+			}
+			return connectStored(store, credentials)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// connectStored creates a bridge for the given credentials which saves
+// address changes to the store.
+func connectStored(store CredentialStore, credentials Credentials) (*Bridge, error) {
+	bridge := NewBridge(credentials.IPAddr, credentials.Username)
+	bridge.clientKey = credentials.ClientKey
+	err := bridge.EnableRediscovery(credentials.BridgeID, func(change AddressChange) {
+		credentials.IPAddr = change.NewAddr
+		store.Save(credentials)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bridge, nil
+}
@@ -0,0 +1,106 @@
+package hue
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+)
+
+// Implementations of the hue API which can be found by discovery.
+const (
+	ImplementationHue    = "hue"
+	ImplementationDiyHue = "diyhue"
+	ImplementationDeCONZ = "deconz"
+)
+
+// Device type announced in the UPnP description of all bridges.
+const basicDeviceType = "urn:schemas-upnp-org:device:Basic:1"
+
+// Manufacturers announced by hue bridges and compatible implementations.
+// Older bridges (and most emulators) still report Royal Philips Electronics.
+var knownManufacturers = []string{
+	"royal philips electronics",
+	"philips lighting bv",
+	"signify",
+	"dresden elektronik",
+}
+
+// bridgeDescription contains the relevant parts of the UPnP description (description.xml) of a bridge.
+type bridgeDescription struct {
+	URLBase string `xml:"URLBase"`
+	Device  struct {
+		DeviceType       string `xml:"deviceType"`
+		FriendlyName     string `xml:"friendlyName"`
+		Manufacturer     string `xml:"manufacturer"`
+		ManufacturerURL  string `xml:"manufacturerURL"`
+		ModelDescription string `xml:"modelDescription"`
+		ModelName        string `xml:"modelName"`
+		ModelNumber      string `xml:"modelNumber"`
+		ModelURL         string `xml:"modelURL"`
+		SerialNumber     string `xml:"serialNumber"`
+		UDN              string `xml:"UDN"`
+	} `xml:"device"`
+}
+
+// parseDescription decodes the given description.xml and makes sure it
+// describes a hue bridge or a compatible implementation.
+func parseDescription(data []byte) (*bridgeDescription, error) {
+	var description bridgeDescription
+	err := xml.Unmarshal(data, &description)
+	if err != nil {
+		return nil, err
+	}
+
+	device := description.Device
+	if strings.TrimSpace(device.DeviceType) != basicDeviceType {
+		return nil, errors.New("Device is no UPnP basic device")
+	}
+	if !containsAny(device.ModelName+" "+device.ModelDescription, "hue") {
+		return nil, errors.New("Device is no hue bridge")
+	}
+	if !containsAny(device.Manufacturer, knownManufacturers...) {
+		return nil, errors.New("Unknown bridge manufacturer " + device.Manufacturer)
+	}
+	return &description, nil
+}
+
+// implementation detects which software implements the bridge. The (public)
+// configuration is optional and helps to identify emulators, as they tend to
+// copy the description of the original bridge.
+func (description *bridgeDescription) implementation(config *Configuration) string {
+	device := description.Device
+	fields := []string{device.FriendlyName, device.Manufacturer, device.ManufacturerURL, device.ModelDescription, device.ModelURL}
+	if config != nil {
+		fields = append(fields, config.Name, config.ModelId)
+	}
+	identity := strings.Join(fields, " ")
+
+	switch {
+	case containsAny(identity, "deconz", "phoscon", "dresden"):
+		return ImplementationDeCONZ
+	case containsAny(identity, "diyhue"):
+		return ImplementationDiyHue
+	default:
+		return ImplementationHue
+	}
+}
+
+// bridgeID derives the bridge ID from the serial number (MAC address) of the bridge.
+func (description *bridgeDescription) bridgeID() string {
+	serial := strings.TrimSpace(description.Device.SerialNumber)
+	if len(serial) != 12 {
+		return ""
+	}
+	return strings.ToUpper(serial[:6] + "fffe" + serial[6:])
+}
+
+// containsAny reports whether str contains any of the given substrings, ignoring case.
+func containsAny(str string, substrings ...string) bool {
+	str = strings.ToLower(str)
+	for _, substring := range substrings {
+		if strings.Contains(str, substring) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,10 +1,12 @@
 package hue
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
-	"fmt"
 	"github.com/stefanwichmann/lanscan"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -12,95 +14,388 @@ import (
 
 const discoveryTimeout = 3 * time.Second
 
+// DiscoveryStrategy is a method to find hosts which might be hue bridges.
+type DiscoveryStrategy interface {
+	// Name identifies the strategy, e.g. "mdns".
+	Name() string
+
+	// Discover sends all found hosts to the given channel. It returns as soon
+	// as the strategy is exhausted or the context is done.
+	Discover(ctx context.Context, hosts chan<- DiscoveredHost) error
+}
+
+// DiscoveredHost is a host found by a DiscoveryStrategy. Strategies fill in
+// the bridge ID and model if they are announced by the bridge.
+type DiscoveredHost struct {
+	Host     string
+	BridgeID string
+	ModelID  string
+}
+
+// DiscoveryResult describes a bridge found by a Discoverer.
+type DiscoveryResult struct {
+	Bridge     *Bridge
+	BridgeID   string
+	ModelID    string
+	Name       string
+	APIVersion string
+	// Implementation is one of the Implementation constants.
+	Implementation string
+	// Method is the name of the strategy which found the bridge.
+	Method string
+}
+
+// Discoverer finds hue bridges using several strategies in parallel.
+// All hosts found are validated and every bridge is reported once,
+// even if it is found by several strategies or at several addresses.
+type Discoverer struct {
+	// Strategies are started immediately and run in parallel.
+	Strategies []DiscoveryStrategy
+
+	// Fallback strategies are started if the Strategies didn't find any
+	// bridge within FallbackDelay (or finished without finding one).
+	Fallback      []DiscoveryStrategy
+	FallbackDelay time.Duration
+}
+
+// NewDiscoverer returns a Discoverer using mDNS, SSDP and N-UPnP and
+// a scan of the local network as fallback.
+func NewDiscoverer() *Discoverer {
+	return &Discoverer{
+		Strategies:    []DiscoveryStrategy{MDNSDiscovery(), SSDPDiscovery(), NUPnPDiscovery()},
+		Fallback:      []DiscoveryStrategy{LANScanDiscovery()},
+		FallbackDelay: discoveryTimeout,
+	}
+}
+
 // DiscoverBridges is a two-step approach trying to find your hue bridges.
-// First it will try to discover bridges in your network using UPnP and it
-// will utilize the hue api (https://www.meethue.com/api/nupnp) to
-// fetch a list of known bridges at the current location in parallel.
+// First it will try to discover bridges in your network using mDNS (the
+// method recommended by Philips) and UPnP and it will utilize the hue api
+// (https://discovery.meethue.com) to fetch a list of known bridges at the
+// current location in parallel.
 // Should this fail it will automatically scan all hosts in your local
 // network and identify any bridges you have running.
 // If the parameter discoverAllBridges is true the discovery will wait for all
 // bridges to respond. When set to false, this method will return as soon as it
 // found the first bridge in your network.
+// Use a Discoverer to control the strategies in use.
 func DiscoverBridges(discoverAllBridges bool) ([]Bridge, error) {
-	hostChannel := make(chan string, 10)
-	bridgeChannel := make(chan string, 10)
-
-	// Start UPnP and N-UPnP discovery in parallel
-	go upnpDiscover(hostChannel)
-	go nupnpDiscover(hostChannel)
-	go validateBridges(hostChannel, bridgeChannel)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	var bridges = []Bridge{}
-	scanStarted := false
-loop:
-	for {
-		select {
-		case bridge, more := <-bridgeChannel:
-			if !more && len(bridges) > 0 {
-				return bridges, nil
-			}
-			if !more {
-				break loop
-			}
-			bridges = append(bridges, *NewBridge(bridge, ""))
-			if !discoverAllBridges {
-				return bridges, nil
-			}
-		case <-time.After(discoveryTimeout):
-			if len(bridges) > 0 {
-				return bridges, nil
+	for result := range NewDiscoverer().Stream(ctx) {
+		bridges = append(bridges, *result.Bridge)
+		if !discoverAllBridges {
+			break
+		}
+	}
+
+	if len(bridges) == 0 {
+		// Nothing found
+		return bridges, errors.New("Bridge discovery failed")
+	}
+	return bridges, nil
+}
+
+// Discover runs all strategies and returns the identity of all bridges found.
+func (discoverer *Discoverer) Discover(ctx context.Context) ([]DiscoveryResult, error) {
+	var results = []DiscoveryResult{}
+	for result := range discoverer.Stream(ctx) {
+		results = append(results, result)
+	}
+
+	if len(results) == 0 {
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+		return results, errors.New("Bridge discovery failed")
+	}
+	return results, nil
+}
+
+// Stream runs all strategies and sends every bridge to the returned channel
+// as soon as it is found. The channel is closed once all strategies finished
+// or the context is done.
+func (discoverer *Discoverer) Stream(ctx context.Context) <-chan DiscoveryResult {
+	results := make(chan DiscoveryResult)
+
+	go func() {
+		defer close(results)
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		candidates := make(chan discoveredCandidate)
+		primaryDone := runStrategies(ctx, discoverer.Strategies, candidates)
+		var fallbackDone <-chan struct{}
+		fallbackTimer := time.NewTimer(discoverer.FallbackDelay)
+		defer fallbackTimer.Stop()
+
+		client := newTimeoutClient()
+		probed := make(map[string]bool)
+		probes := make(chan *DiscoveryResult)
+		pending := 0
+		found := make(map[string]bool)
+		running := 1
+		fallbackStarted := false
+		startFallback := func() {
+			if len(found) == 0 && pending == 0 && !fallbackStarted && len(discoverer.Fallback) > 0 {
+				fallbackStarted = true
+				fallbackDone = runStrategies(ctx, discoverer.Fallback, candidates)
+				running++
 			}
-			if !scanStarted {
-				// UPnP and N-UPnP didn't discover any bridges.
-				// Start a LAN scan and feed results to hostChannel.
-				scanLocalNetwork(hostChannel)
-				scanStarted = true
-				continue // Loop again with same timeout
+		}
+
+		for running > 0 || pending > 0 {
+			select {
+			case candidate := <-candidates:
+				if probed[candidate.Host] {
+					continue
+				}
+				probed[candidate.Host] = true
+				pending++
+				go func(candidate discoveredCandidate) {
+					select {
+					case probes <- probeBridge(ctx, client, candidate):
+					case <-ctx.Done():
+					}
+				}(candidate)
+			case result := <-probes:
+				pending--
+				if result == nil {
+					if primaryDone == nil {
+						startFallback()
+					}
+					continue
+				}
+				key := result.BridgeID
+				if key == "" {
+					key = result.Bridge.IpAddr
+				}
+				if found[key] {
+					continue
+				}
+				found[key] = true
+				select {
+				case results <- *result:
+				case <-ctx.Done():
+					return
+				}
+			case <-fallbackTimer.C:
+				startFallback()
+			case <-primaryDone:
+				primaryDone = nil
+				running--
+				startFallback()
+			case <-fallbackDone:
+				fallbackDone = nil
+				running--
+			case <-ctx.Done():
+				return
 			}
-			break loop
 		}
-	}
+	}()
 
-	// Nothing found
-	return bridges, errors.New("Bridge discovery failed")
+	return results
 }
 
-func scanLocalNetwork(hostChannel chan<- string) {
-	hosts, err := lanscan.ScanLinkLocal("tcp4", 80, 20, discoveryTimeout-1*time.Second)
-	if err == nil {
+// MDNSDiscovery finds bridges announcing the _hue._tcp service via mDNS.
+func MDNSDiscovery() DiscoveryStrategy {
+	return &discoveryStrategy{name: "mdns", timeout: mdnsTimeout, discover: mdnsDiscover}
+}
+
+// SSDPDiscovery finds bridges using UPnP (SSDP) via IPv4 and IPv6 multicast
+// on all network interfaces.
+func SSDPDiscovery() DiscoveryStrategy {
+	return SSDPDiscoveryOn()
+}
+
+// SSDPDiscoveryOn finds bridges using UPnP (SSDP) on the given network
+// interfaces only (all if none are given).
+func SSDPDiscoveryOn(ifaces ...net.Interface) DiscoveryStrategy {
+	return &discoveryStrategy{name: "ssdp", timeout: upnpTimeout, discover: func(ctx context.Context, respondingHosts chan<- DiscoveredHost) error {
+		return upnpDiscover(ctx, ifaces, respondingHosts)
+	}}
+}
+
+// NUPnPDiscovery fetches all bridges known at the current location from the
+// hue discovery service (requires internet access).
+func NUPnPDiscovery() DiscoveryStrategy {
+	return &discoveryStrategy{name: "nupnp", timeout: discoveryTimeout, discover: nupnpDiscover}
+}
+
+// LANScanDiscovery scans all hosts of the local (IPv4) network for a web server.
+func LANScanDiscovery() DiscoveryStrategy {
+	return &discoveryStrategy{name: "lanscan", timeout: discoveryTimeout, discover: scanLocalNetwork}
+}
+
+// StaticDiscovery reports the given hosts, e.g. known addresses of bridges.
+func StaticDiscovery(hosts ...string) DiscoveryStrategy {
+	return &discoveryStrategy{name: "static", discover: func(ctx context.Context, respondingHosts chan<- DiscoveredHost) error {
 		for _, host := range hosts {
-			hostChannel <- host
+			select {
+			case respondingHosts <- DiscoveredHost{Host: host}:
+			case <-ctx.Done():
+				return nil
+			}
 		}
+		return nil
+	}}
+}
+
+// WithTimeout limits the runtime of the given strategy.
+func WithTimeout(strategy DiscoveryStrategy, timeout time.Duration) DiscoveryStrategy {
+	return &discoveryStrategy{name: strategy.Name(), timeout: timeout, discover: strategy.Discover}
+}
+
+type discoveryStrategy struct {
+	name     string
+	timeout  time.Duration
+	discover func(ctx context.Context, respondingHosts chan<- DiscoveredHost) error
+}
+
+func (strategy *discoveryStrategy) Name() string {
+	return strategy.name
+}
+
+func (strategy *discoveryStrategy) Discover(ctx context.Context, hosts chan<- DiscoveredHost) error {
+	var cancel context.CancelFunc
+	if strategy.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, strategy.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
 	}
-	close(hostChannel)
+	defer cancel()
+
+	return strategy.discover(ctx, hosts)
+}
+
+// discoveredCandidate is a host found by the strategy with the given name.
+type discoveredCandidate struct {
+	DiscoveredHost
+	method string
 }
 
-func validateBridges(candidates <-chan string, bridges chan<- string) {
-	for candidate := range candidates {
-		resp, err := http.Get(fmt.Sprintf("http://%s/description.xml", candidate))
-		if err != nil {
-			continue
+// runStrategies starts all given strategies and forwards their hosts as
+// candidates. The returned channel is closed once all strategies finished.
+func runStrategies(ctx context.Context, strategies []DiscoveryStrategy, candidates chan<- discoveredCandidate) <-chan struct{} {
+	done := make(chan struct{})
+	finished := make(chan struct{}, len(strategies))
+
+	for _, strategy := range strategies {
+		go func(strategy DiscoveryStrategy) {
+			defer func() { finished <- struct{}{} }()
+
+			hosts := make(chan DiscoveredHost)
+			forwarded := make(chan struct{})
+			go func() {
+				defer close(forwarded)
+				for host := range hosts {
+					select {
+					case candidates <- discoveredCandidate{DiscoveredHost: host, method: strategy.Name()}:
+					case <-ctx.Done():
+					}
+				}
+			}()
+
+			strategy.Discover(ctx, hosts)
+			close(hosts)
+			<-forwarded
+		}(strategy)
+	}
+
+	go func() {
+		for range strategies {
+			<-finished
 		}
-		defer resp.Body.Close()
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			continue
+		close(done)
+	}()
+	return done
+}
+
+// closeOnDone applies the deadline of the context to the given connection and
+// closes it as soon as the context is done, so blocking reads return.
+func closeOnDone(ctx context.Context, conn net.Conn) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+}
+
+func scanLocalNetwork(ctx context.Context, hostChannel chan<- DiscoveredHost) error {
+	hosts, err := lanscan.ScanLinkLocal("tcp4", 80, 20, discoveryTimeout-1*time.Second)
+	if err != nil {
+		return err
+	}
+	for _, host := range hosts {
+		select {
+		case hostChannel <- DiscoveredHost{Host: host}:
+		case <-ctx.Done():
+			return nil
 		}
+	}
+	return nil
+}
 
-		// make sure it's a hue bridge
-		str := string(body)
-		if !strings.Contains(str, "<deviceType>urn:schemas-upnp-org:device:Basic:1</deviceType>") {
-			continue
+// probeBridge validates the candidate and collects the identity of the bridge
+// from its description and public configuration. Returns nil if the candidate
+// is no hue bridge.
+func probeBridge(ctx context.Context, client *http.Client, candidate discoveredCandidate) *DiscoveryResult {
+	body, err := fetch(ctx, client, hostURL("http", candidate.Host, "/description.xml"))
+	if err != nil {
+		return nil
+	}
+	description, err := parseDescription(body)
+	if err != nil {
+		return nil
+	}
+
+	result := DiscoveryResult{
+		Bridge:   NewBridge(candidate.Host, ""),
+		BridgeID: candidate.BridgeID,
+		ModelID:  candidate.ModelID,
+		Name:     description.Device.FriendlyName,
+		Method:   candidate.method,
+	}
+	if result.ModelID == "" {
+		result.ModelID = description.Device.ModelNumber
+	}
+	if result.BridgeID == "" {
+		result.BridgeID = description.bridgeID()
+	}
+
+	// The public configuration is available without username
+	var config *Configuration
+	body, err = fetch(ctx, client, hostURL("http", candidate.Host, "/api/config"))
+	if err == nil && json.Unmarshal(body, &config) == nil && config != nil {
+		result.APIVersion = config.APIVersion
+		if config.Name != "" {
+			result.Name = config.Name
 		}
-		if !strings.Contains(str, "<manufacturer>Royal Philips Electronics</manufacturer>") {
-			continue
+		if config.BridgeId != "" {
+			result.BridgeID = strings.ToUpper(config.BridgeId)
 		}
-		if !strings.Contains(str, "<modelURL>http://www.meethue.com</modelURL>") {
-			continue
+		if config.ModelId != "" {
+			result.ModelID = config.ModelId
 		}
+	}
+	result.Implementation = description.implementation(config)
 
-		// Candidate seems to be a valid hue bridge
-		bridges <- candidate
+	return &result
+}
+
+func fetch(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
 	}
-	close(bridges)
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
 }
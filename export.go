@@ -0,0 +1,166 @@
+package hue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Version of the portable scene format written by Scene.Export.
+const portableSceneVersion = 1
+
+// PortableScene is a bridge independent representation of a scene.
+// Lights are identified by their unique id (and name as fallback) instead
+// of the bridge local light IDs, so the scene can be imported on other bridges.
+type PortableScene struct {
+	Version int                    `json:"version"`
+	Name    string                 `json:"name"`
+	Appdata map[string]interface{} `json:"appdata,omitempty"`
+	Picture string                 `json:"picture,omitempty"`
+	Lights  []PortableLightState   `json:"lights"`
+}
+
+// PortableLightState contains the stored state of a single light in a PortableScene.
+type PortableLightState struct {
+	UniqueId string           `json:"uniqueid"`
+	Name     string           `json:"name"`
+	State    ModifyLightState `json:"state"`
+}
+
+// ImportReport describes the outcome of importing a PortableScene.
+type ImportReport struct {
+	SceneId string
+	Created bool
+	// Mapped contains the target light ID for every light mapped by unique id.
+	Mapped map[string]string
+	// MappedByName contains the target light ID for every light mapped by name.
+	MappedByName map[string]string
+	// Unmapped contains all light states without a matching light on the bridge.
+	Unmapped []PortableLightState
+}
+
+// ReadPortableScene decodes a scene written by PortableScene.Write.
+func ReadPortableScene(r io.Reader) (*PortableScene, error) {
+	var doc PortableScene
+	err := json.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Version != portableSceneVersion {
+		return nil, fmt.Errorf("Unsupported scene format version %d", doc.Version)
+	}
+	return &doc, nil
+}
+
+// Write encodes the scene as JSON document.
+func (doc *PortableScene) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// Export converts the scene into a portable document.
+func (scene *Scene) Export() (*PortableScene, error) {
+	// Light states are read as stored, so zero values like hue 0 are kept
+	stored, err := scene.bridge.storedSceneByID(scene.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	lights, err := scene.bridge.GetAllLights()
+	if err != nil {
+		return nil, err
+	}
+	lightsByID := make(map[string]*Light)
+	for _, light := range lights {
+		lightsByID[light.Id] = light
+	}
+
+	doc := PortableScene{Version: portableSceneVersion, Name: stored.Name, Appdata: stored.Appdata, Picture: stored.Picture}
+	for lightID, lightstate := range stored.LightStates {
+		light, ok := lightsByID[lightID]
+		if !ok {
+			return nil, errors.New("Unable to find light with id " + lightID)
+		}
+		doc.Lights = append(doc.Lights, PortableLightState{
+			UniqueId: light.Attributes.UniqueId,
+			Name:     light.Name,
+			State:    lightstate,
+		})
+	}
+	sort.Slice(doc.Lights, func(i, j int) bool { return doc.Lights[i].UniqueId < doc.Lights[j].UniqueId })
+
+	return &doc, nil
+}
+
+// ImportScene stores the given portable scene on the bridge. Lights are mapped
+// by unique id or, if no light with this id exists, by their unique name.
+// An existing scene with the same name is updated (lights, light states,
+// appdata and picture), otherwise a new scene is created.
+func (bridge *Bridge) ImportScene(doc *PortableScene) (*ImportReport, error) {
+	lights, err := bridge.GetAllLights()
+	if err != nil {
+		return nil, err
+	}
+	byUniqueID := make(map[string]string)
+	byName := make(map[string][]string)
+	for _, light := range lights {
+		byUniqueID[light.Attributes.UniqueId] = light.Id
+		byName[light.Name] = append(byName[light.Name], light.Id)
+	}
+
+	report := ImportReport{Mapped: make(map[string]string), MappedByName: make(map[string]string)}
+	lightstates := make(map[string]ModifyLightState)
+	for _, portable := range doc.Lights {
+		lightID, ok := byUniqueID[portable.UniqueId]
+		switch {
+		case ok && portable.UniqueId != "":
+			report.Mapped[portable.UniqueId] = lightID
+		case len(byName[portable.Name]) == 1:
+			lightID = byName[portable.Name][0]
+			report.MappedByName[portable.Name] = lightID
+		default:
+			report.Unmapped = append(report.Unmapped, portable)
+			continue
+		}
+		lightstates[lightID] = portable.State
+	}
+	if len(lightstates) == 0 {
+		return &report, errors.New("Unable to map any light of scene " + doc.Name)
+	}
+
+	var lightIDs []string
+	for lightID := range lightstates {
+		lightIDs = append(lightIDs, lightID)
+	}
+	sort.Strings(lightIDs)
+
+	scenes, err := bridge.AllScenes()
+	if err != nil {
+		return &report, err
+	}
+	for _, scene := range scenes {
+		if scene.Name == doc.Name {
+			report.SceneId = scene.Id
+			_, err = scene.Modify(ModifyScene{Lights: lightIDs, Appdata: doc.Appdata, Picture: doc.Picture, LightStates: lightstates})
+			return &report, err
+		}
+	}
+
+	results, err := bridge.CreateScene(CreateScene{
+		Name:        doc.Name,
+		Type:        LightScene,
+		Lights:      lightIDs,
+		Appdata:     doc.Appdata,
+		Picture:     doc.Picture,
+		LightStates: lightstates,
+	})
+	if err != nil {
+		return &report, err
+	}
+	report.SceneId, err = createdID(results)
+	report.Created = err == nil
+	return &report, err
+}
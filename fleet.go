@@ -0,0 +1,340 @@
+package hue
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fleet manages several bridges as one installation. Lights, groups and
+// scenes of all bridges are addressed by global IDs of the form
+// <bridge ID>/<ID>, e.g. 001788FFFE09A206/3.
+type Fleet struct {
+	lock    sync.Mutex
+	bridges map[string]*Bridge
+}
+
+// FleetLight is a light of a bridge in the fleet.
+type FleetLight struct {
+	*Light
+	GlobalID string
+	BridgeID string
+}
+
+// FleetGroup is a group of a bridge in the fleet.
+type FleetGroup struct {
+	*Group
+	GlobalID string
+	BridgeID string
+}
+
+// FleetScene is a scene of a bridge in the fleet.
+type FleetScene struct {
+	*Scene
+	GlobalID string
+	BridgeID string
+}
+
+// BridgeHealth describes the state of a single bridge in the fleet.
+type BridgeHealth struct {
+	Reachable  bool
+	Authorized bool
+	Latency    time.Duration
+	APIVersion string
+	Err        error
+}
+
+// FleetHealth contains the health of all bridges keyed by bridge ID.
+type FleetHealth map[string]BridgeHealth
+
+// FleetError is returned if some bridges of the fleet failed. Results of
+// all other bridges are returned nevertheless.
+type FleetError struct {
+	Errors map[string]error
+}
+
+func (err *FleetError) Error() string {
+	var messages []string
+	for _, bridgeID := range sortedIDs(err.Errors) {
+		messages = append(messages, fmt.Sprintf("%s: %v", bridgeID, err.Errors[bridgeID]))
+	}
+	return "Bridges failed: " + strings.Join(messages, "; ")
+}
+
+// NewFleet returns an empty fleet.
+func NewFleet() *Fleet {
+	return &Fleet{bridges: make(map[string]*Bridge)}
+}
+
+// Add adds the bridge to the fleet. If bridgeID is empty, the ID is taken
+// from EnableRediscovery or read from the bridge configuration.
+func (fleet *Fleet) Add(bridgeID string, bridge *Bridge) error {
+	if bridgeID == "" {
+		bridgeID = bridge.BridgeID()
+	}
+	if bridgeID == "" {
+		config, err := bridge.Configuration()
+		if err != nil {
+			return err
+		}
+		if config.BridgeId == "" {
+			return errors.New("Bridge reported no bridge ID")
+		}
+		bridgeID = config.BridgeId
+	}
+	bridgeID = strings.ToUpper(bridgeID)
+
+	fleet.lock.Lock()
+	defer fleet.lock.Unlock()
+
+	if _, ok := fleet.bridges[bridgeID]; ok {
+		return errors.New("Bridge " + bridgeID + " is already part of the fleet")
+	}
+	fleet.bridges[bridgeID] = bridge
+	return nil
+}
+
+// Remove removes the bridge with the given ID from the fleet.
+func (fleet *Fleet) Remove(bridgeID string) {
+	fleet.lock.Lock()
+	defer fleet.lock.Unlock()
+
+	delete(fleet.bridges, strings.ToUpper(bridgeID))
+}
+
+// Bridge returns the bridge with the given ID.
+func (fleet *Fleet) Bridge(bridgeID string) (*Bridge, error) {
+	fleet.lock.Lock()
+	defer fleet.lock.Unlock()
+
+	bridge, ok := fleet.bridges[strings.ToUpper(bridgeID)]
+	if !ok {
+		return nil, errors.New("Unable to find bridge " + bridgeID)
+	}
+	return bridge, nil
+}
+
+// BridgeIDs returns the IDs of all bridges in the fleet.
+func (fleet *Fleet) BridgeIDs() []string {
+	fleet.lock.Lock()
+	defer fleet.lock.Unlock()
+
+	return sortedIDs(fleet.bridges)
+}
+
+// AllLights returns the lights of all bridges.
+func (fleet *Fleet) AllLights() ([]FleetLight, error) {
+	var lock sync.Mutex
+	var lights []FleetLight
+	err := fleet.each(func(bridgeID string, bridge *Bridge) error {
+		found, err := bridge.GetAllLights()
+		if err != nil {
+			return err
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		for _, light := range found {
+			lights = append(lights, FleetLight{Light: light, GlobalID: GlobalID(bridgeID, light.Id), BridgeID: bridgeID})
+		}
+		return nil
+	})
+	sort.Slice(lights, func(i, j int) bool { return lights[i].GlobalID < lights[j].GlobalID })
+	return lights, err
+}
+
+// AllGroups returns the groups of all bridges.
+func (fleet *Fleet) AllGroups() ([]FleetGroup, error) {
+	var lock sync.Mutex
+	var groups []FleetGroup
+	err := fleet.each(func(bridgeID string, bridge *Bridge) error {
+		found, err := bridge.AllGroups()
+		if err != nil {
+			return err
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		for _, group := range found {
+			groups = append(groups, FleetGroup{Group: group, GlobalID: GlobalID(bridgeID, group.Id), BridgeID: bridgeID})
+		}
+		return nil
+	})
+	sort.Slice(groups, func(i, j int) bool { return groups[i].GlobalID < groups[j].GlobalID })
+	return groups, err
+}
+
+// AllScenes returns the scenes of all bridges.
+func (fleet *Fleet) AllScenes() ([]FleetScene, error) {
+	var lock sync.Mutex
+	var scenes []FleetScene
+	err := fleet.each(func(bridgeID string, bridge *Bridge) error {
+		found, err := bridge.AllScenes()
+		if err != nil {
+			return err
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		for _, scene := range found {
+			scenes = append(scenes, FleetScene{Scene: scene, GlobalID: GlobalID(bridgeID, scene.Id), BridgeID: bridgeID})
+		}
+		return nil
+	})
+	sort.Slice(scenes, func(i, j int) bool { return scenes[i].GlobalID < scenes[j].GlobalID })
+	return scenes, err
+}
+
+// LightByID looks up the light with the given global ID.
+func (fleet *Fleet) LightByID(globalID string) (*FleetLight, error) {
+	bridgeID, bridge, id, err := fleet.resolve(globalID)
+	if err != nil {
+		return nil, err
+	}
+	light, err := bridge.FindLightById(id)
+	if err != nil {
+		return nil, err
+	}
+	return &FleetLight{Light: light, GlobalID: GlobalID(bridgeID, id), BridgeID: bridgeID}, nil
+}
+
+// GroupByID looks up the group with the given global ID.
+func (fleet *Fleet) GroupByID(globalID string) (*FleetGroup, error) {
+	bridgeID, bridge, id, err := fleet.resolve(globalID)
+	if err != nil {
+		return nil, err
+	}
+	group, err := bridge.GroupByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return &FleetGroup{Group: group, GlobalID: GlobalID(bridgeID, id), BridgeID: bridgeID}, nil
+}
+
+// SceneByID looks up the scene with the given global ID.
+func (fleet *Fleet) SceneByID(globalID string) (*FleetScene, error) {
+	bridgeID, bridge, id, err := fleet.resolve(globalID)
+	if err != nil {
+		return nil, err
+	}
+	scene, err := bridge.SceneByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return &FleetScene{Scene: scene, GlobalID: GlobalID(bridgeID, id), BridgeID: bridgeID}, nil
+}
+
+// SetState sets the state of the light with the given global ID.
+func (fleet *Fleet) SetState(globalID string, state SetLightState) ([]Result, error) {
+	_, bridge, id, err := fleet.resolve(globalID)
+	if err != nil {
+		return nil, err
+	}
+	light := &Light{Id: id, bridge: bridge}
+	return light.SetState(state)
+}
+
+// SetGroupState sets the state of all lights in the group with the given global ID.
+func (fleet *Fleet) SetGroupState(globalID string, state SetLightState) ([]Result, error) {
+	_, bridge, id, err := fleet.resolve(globalID)
+	if err != nil {
+		return nil, err
+	}
+	group := &Group{Id: id, bridge: bridge}
+	return group.SetState(state)
+}
+
+// Health checks all bridges concurrently. A bridge is authorized if its
+// username is accepted (i.e. the whitelist is part of the configuration).
+func (fleet *Fleet) Health() FleetHealth {
+	var lock sync.Mutex
+	health := make(FleetHealth)
+	fleet.each(func(bridgeID string, bridge *Bridge) error {
+		start := time.Now()
+		config, err := bridge.Configuration()
+		state := BridgeHealth{Latency: time.Since(start), Err: err}
+		if err == nil {
+			state.Reachable = true
+			state.Authorized = len(config.Whitelist) > 0
+			state.APIVersion = config.APIVersion
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		health[bridgeID] = state
+		return nil
+	})
+	return health
+}
+
+// Healthy reports whether all bridges are reachable and authorized.
+func (health FleetHealth) Healthy() bool {
+	for _, state := range health {
+		if !state.Reachable || !state.Authorized {
+			return false
+		}
+	}
+	return true
+}
+
+// GlobalID returns the fleet wide ID of a resource on the given bridge.
+func GlobalID(bridgeID, id string) string {
+	return strings.ToUpper(bridgeID) + "/" + id
+}
+
+// SplitGlobalID returns the bridge ID and the resource ID of a global ID.
+func SplitGlobalID(globalID string) (string, string, error) {
+	parts := strings.SplitN(globalID, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.New("Invalid global ID " + globalID)
+	}
+	return strings.ToUpper(parts[0]), parts[1], nil
+}
+
+// resolve returns the bridge ID, bridge and resource ID of a global ID.
+func (fleet *Fleet) resolve(globalID string) (string, *Bridge, string, error) {
+	bridgeID, id, err := SplitGlobalID(globalID)
+	if err != nil {
+		return "", nil, "", err
+	}
+	bridge, err := fleet.Bridge(bridgeID)
+	if err != nil {
+		return "", nil, "", err
+	}
+	return bridgeID, bridge, id, nil
+}
+
+// each calls fn for all bridges concurrently. Errors are collected in a FleetError.
+func (fleet *Fleet) each(fn func(bridgeID string, bridge *Bridge) error) error {
+	fleet.lock.Lock()
+	bridges := make(map[string]*Bridge, len(fleet.bridges))
+	for bridgeID, bridge := range fleet.bridges {
+		bridges[bridgeID] = bridge
+	}
+	fleet.lock.Unlock()
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(map[string]error)
+	for bridgeID, bridge := range bridges {
+		wg.Add(1)
+		go func(bridgeID string, bridge *Bridge) {
+			defer wg.Done()
+			err := fn(bridgeID, bridge)
+			if err != nil {
+				lock.Lock()
+				errs[bridgeID] = err
+				lock.Unlock()
+			}
+		}(bridgeID, bridge)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return &FleetError{Errors: errs}
+	}
+	return nil
+}
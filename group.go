@@ -0,0 +1,133 @@
+package hue
+
+import "errors"
+
+// Group represents a group of lights saved on the bridge.
+type Group struct {
+	bridge *Bridge
+	Id     string     `json:"-"`
+	Name   string     `json:"name"`
+	Lights []string   `json:"lights"`
+	Type   string     `json:"type"`
+	Class  string     `json:"class"`
+	Action LightState `json:"action"`
+}
+
+// CreateGroup contains all necessary attributes to create a new group on the bridge.
+// Type is one of LightGroup, Room, Zone or Entertainment. Class is only used for
+// rooms and zones.
+type CreateGroup struct {
+	Name   string   `json:"name,omitempty"`
+	Type   string   `json:"type,omitempty"`
+	Class  string   `json:"class,omitempty"`
+	Lights []string `json:"lights"`
+}
+
+// ModifyGroup contains all attributes to be changed on a given group.
+type ModifyGroup struct {
+	Name   string   `json:"name,omitempty"`
+	Class  string   `json:"class,omitempty"`
+	Lights []string `json:"lights,omitempty"`
+}
+
+// CreateGroup stores a new group with the given attributes on the bridge.
+func (bridge *Bridge) CreateGroup(groupdata CreateGroup) ([]Result, error) {
+	if groupdata.Lights == nil {
+		groupdata.Lights = []string{}
+	}
+
+	err := bridge.checkCapacity(map[string]int{"groups": 1})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	err = bridge.post("/groups", &groupdata, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// AllGroups returns all groups currently saved on the bridge.
+func (bridge *Bridge) AllGroups() ([]*Group, error) {
+	var groups []*Group
+	var results map[string]Group
+	err := bridge.get("/groups", &results)
+	if err != nil {
+		return groups, err
+	}
+
+	// and convert them into groups
+	for id, group := range results {
+		group := group
+		group.Id = id
+		group.bridge = bridge
+		groups = append(groups, &group)
+	}
+
+	return groups, nil
+}
+
+// GroupByID looks up the group with the given ID on the bridge.
+// The special group "0" contains all lights known to the bridge.
+func (bridge *Bridge) GroupByID(id string) (*Group, error) {
+	var result Group
+	err := bridge.get("/groups/"+id, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Id = id
+	result.bridge = bridge
+
+	return &result, nil
+}
+
+// GroupByName looks up the group with the given name on the bridge.
+func (bridge *Bridge) GroupByName(name string) (*Group, error) {
+	groups, err := bridge.AllGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, group := range groups {
+		if group.Name == name {
+			return group, nil
+		}
+	}
+
+	return nil, errors.New("Unable to find group with name " + name)
+}
+
+// SetState sets the state of all lights in the group with a single request.
+func (group *Group) SetState(state SetLightState) ([]Result, error) {
+	params := state.params()
+
+	var results []Result
+	err := group.bridge.put("/groups/"+group.Id+"/action", &params, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Modify adjusts a saved group according to the given attributes.
+func (group *Group) Modify(modifyGroup ModifyGroup) ([]Result, error) {
+	var results []Result
+	err := group.bridge.put("/groups/"+group.Id, &modifyGroup, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Delete will remove the given group from the bridge.
+func (group *Group) Delete() ([]Result, error) {
+	var results []Result
+	err := group.bridge.delete("/groups/"+group.Id, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
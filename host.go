@@ -0,0 +1,41 @@
+package hue
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// hostURL returns the URL of path on the given bridge host. The host may be a
+// host name or an IP address with an optional port, e.g. 192.168.1.2,
+// 192.168.1.2:8080, fe80::1%eth0 or [fe80::1%eth0]:8080. IPv6 addresses
+// with a port have to be enclosed in brackets.
+func hostURL(scheme, host, path string) string {
+	return (&url.URL{Scheme: scheme, Host: urlHost(host), Path: path}).String()
+}
+
+// urlHost encloses IPv6 addresses without port in brackets, so that they can
+// be used as host of an URL.
+func urlHost(host string) string {
+	if strings.HasPrefix(host, "[") || !strings.Contains(host, ":") {
+		return host
+	}
+	address := strings.SplitN(host, "%", 2)[0]
+	if net.ParseIP(address) == nil {
+		return host // host:port
+	}
+	return "[" + host + "]"
+}
+
+// joinHost returns the host for the given IP address (with zone for
+// link-local IPv6 addresses) and port. The default port 80 is omitted.
+func joinHost(ip net.IP, zone string, port string) string {
+	address := ip.String()
+	if zone != "" && ip.To4() == nil && ip.IsLinkLocalUnicast() {
+		address += "%" + zone
+	}
+	if port == "" || port == "80" {
+		return address
+	}
+	return net.JoinHostPort(address, port)
+}
@@ -0,0 +1,90 @@
+package hue
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Call describes a single request to the bridge API.
+type Call struct {
+	Method string
+	// Path is the API path without username, e.g. /lights/1/state.
+	Path string
+	// Request is the request body (nil for GET and DELETE requests).
+	Request interface{}
+	// Result receives the decoded response (may be nil).
+	Result interface{}
+	// Latency of the last request sent to the bridge for this call.
+	Latency time.Duration
+	// parallel calls don't wait for other requests (see StateBatch).
+	parallel bool
+}
+
+// Invoker executes a call.
+type Invoker func(call *Call) error
+
+// Interceptor wraps the execution of calls. It may inspect or modify the
+// call before and after passing it on to next, or answer the call itself
+// (e.g. from a cache) without calling next at all.
+type Interceptor func(call *Call, next Invoker) error
+
+// Use adds interceptors for all API calls of the bridge. Interceptors are
+// executed in the order they were added, the first one being the outermost.
+// Creating users and the HTTPS negotiation don't pass the interceptors.
+func (bridge *Bridge) Use(interceptors ...Interceptor) {
+	bridge.lock.Lock()
+	defer bridge.lock.Unlock()
+
+	// copy, so requests in flight keep their chain
+	chain := make([]Interceptor, 0, len(bridge.interceptors)+len(interceptors))
+	chain = append(chain, bridge.interceptors...)
+	bridge.interceptors = append(chain, interceptors...)
+}
+
+// chain returns an invoker passing calls through all interceptors to invoker.
+func chain(interceptors []Interceptor, invoker Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(call *Call) error {
+			return interceptor(call, next)
+		}
+	}
+	return invoker
+}
+
+// LoggingInterceptor logs every call with its duration. Successful calls
+// are logged with level info, failed calls with level warn.
+func LoggingInterceptor(logger Logger) Interceptor {
+	return func(call *Call, next Invoker) error {
+		start := time.Now()
+		err := next(call)
+		duration := time.Since(start)
+		if err != nil {
+			logger.Log(context.Background(), slog.LevelWarn, "Call failed", "method", call.Method, "path", call.Path, "duration", duration, "latency", call.Latency, "error", err)
+		} else {
+			logger.Log(context.Background(), slog.LevelInfo, "Call", "method", call.Method, "path", call.Path, "duration", duration, "latency", call.Latency)
+		}
+		return err
+	}
+}
+
+// RetryInterceptor retries calls failing because of connection errors up to
+// the given number of attempts in total. The delay between two attempts
+// starts with backoff and doubles with every retry. POST requests are never
+// retried, as they might have created a resource nevertheless.
+func RetryInterceptor(attempts int, backoff time.Duration) Interceptor {
+	return func(call *Call, next Invoker) error {
+		delay := backoff
+		err := next(call)
+		for attempt := 1; attempt < attempts && err != nil; attempt++ {
+			if call.Method == "POST" || !isConnectionError(err) {
+				return err
+			}
+			time.Sleep(delay)
+			delay *= 2
+			err = next(call)
+		}
+		return err
+	}
+}
@@ -73,14 +73,15 @@ type SetLightState struct {
 
 // LightAttributes encapsulates all attributes (hardware and state) for a specific philips hue light
 type LightAttributes struct {
-	State            LightState `json:"state"`
-	Type             string     `json:"type"`
-	Name             string     `json:"name"`
-	ModelId          string     `json:"modelid"`
-	UniqueId         string     `json:"uniqueid"`
-	ManufacturerName string     `json:"manufacturername"`
-	ProductName      string     `json:"productname"`
-	SoftwareVersion  string     `json:"swversion"`
+	State            LightState          `json:"state"`
+	Type             string              `json:"type"`
+	Name             string              `json:"name"`
+	ModelId          string              `json:"modelid"`
+	UniqueId         string              `json:"uniqueid"`
+	ManufacturerName string              `json:"manufacturername"`
+	ProductName      string              `json:"productname"`
+	SoftwareVersion  string              `json:"swversion"`
+	SoftwareUpdate   SoftwareUpdateState `json:"swupdate"`
 }
 
 // GetLightAttributes retrieves light attributes and state as per
@@ -137,6 +138,18 @@ func (light *Light) ColorLoop() ([]Result, error) {
 // SetState sets the state of a light as per
 // http://developers.meethue.com/1_lightsapi.html#16_set_light_state
 func (light *Light) SetState(state SetLightState) ([]Result, error) {
+	params := state.params()
+
+	var results []Result
+	err := light.bridge.put("/lights/"+light.Id+"/state", &params, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// params converts the given state into the request parameters expected by the bridge.
+func (state SetLightState) params() map[string]interface{} {
 	params := make(map[string]interface{})
 
 	if state.On != "" {
@@ -167,11 +180,74 @@ func (light *Light) SetState(state SetLightState) ([]Result, error) {
 	if state.TransitionTime != "" {
 		params["transitiontime"], _ = strconv.Atoi(state.TransitionTime)
 	}
+	return params
+}
 
-	var results []Result
-	err := light.bridge.put("/lights/"+light.Id+"/state", &params, &results)
-	if err != nil {
-		return nil, err
+// sceneState converts the given state into a light state which can be stored in a scene.
+// Alert effects can't be stored and are ignored.
+func (state SetLightState) sceneState() ModifyLightState {
+	var lightstate ModifyLightState
+
+	if state.On != "" {
+		value, _ := strconv.ParseBool(state.On)
+		lightstate.On = &value
 	}
-	return results, nil
+	if state.Bri != "" {
+		value, _ := strconv.ParseUint(state.Bri, 10, 8)
+		lightstate.Brightness = uint8(value)
+	}
+	if state.Hue != "" {
+		value, _ := strconv.ParseUint(state.Hue, 10, 16)
+		hue := uint16(value)
+		lightstate.Hue = &hue
+	}
+	if state.Sat != "" {
+		value, _ := strconv.ParseUint(state.Sat, 10, 8)
+		sat := uint8(value)
+		lightstate.Saturation = &sat
+	}
+	lightstate.Xy = state.Xy
+	if state.Ct != "" {
+		value, _ := strconv.ParseUint(state.Ct, 10, 16)
+		lightstate.ColorTemperature = uint16(value)
+	}
+	lightstate.Effect = state.Effect
+	if state.TransitionTime != "" {
+		value, _ := strconv.ParseUint(state.TransitionTime, 10, 16)
+		transitionTime := uint16(value)
+		lightstate.TransitionTime = &transitionTime
+	}
+	return lightstate
+}
+
+// merge overlays all attributes set in update onto the given state.
+func (state SetLightState) merge(update SetLightState) SetLightState {
+	if update.On != "" {
+		state.On = update.On
+	}
+	if update.Bri != "" {
+		state.Bri = update.Bri
+	}
+	if update.Hue != "" {
+		state.Hue = update.Hue
+	}
+	if update.Sat != "" {
+		state.Sat = update.Sat
+	}
+	if update.Xy != nil {
+		state.Xy = update.Xy
+	}
+	if update.Ct != "" {
+		state.Ct = update.Ct
+	}
+	if update.Alert != "" {
+		state.Alert = update.Alert
+	}
+	if update.Effect != "" {
+		state.Effect = update.Effect
+	}
+	if update.TransitionTime != "" {
+		state.TransitionTime = update.TransitionTime
+	}
+	return state
 }
@@ -0,0 +1,76 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Replacement for credentials in log messages.
+const redacted = "REDACTED"
+
+// Logger receives the log messages of a bridge. The method matches
+// (*slog.Logger).Log, so a *slog.Logger can be used directly.
+type Logger interface {
+	Log(ctx context.Context, level slog.Level, msg string, args ...interface{})
+}
+
+// Credentials of other applications contained in responses: the keys of the
+// whitelist and the fields returned when creating a user.
+var (
+	whitelistKey    = regexp.MustCompile(`"[^"]+"(\s*:\s*\{\s*"(last use date|create date|name)")`)
+	credentialField = regexp.MustCompile(`("(username|clientkey)"\s*:\s*)"[^"]*"`)
+)
+
+// SetLogger sends log messages of all requests to the given logger (nil
+// disables logging). Requests and responses are logged with level debug,
+// failed requests with level warn. Usernames and client keys are redacted.
+func (bridge *Bridge) SetLogger(logger Logger) {
+	bridge.lock.Lock()
+	defer bridge.lock.Unlock()
+
+	bridge.logger = logger
+}
+
+// log sends a message to the logger of the bridge, if any.
+func (bridge *Bridge) log(level slog.Level, msg string, args ...interface{}) {
+	bridge.lock.Lock()
+	logger := bridge.logger
+	bridge.lock.Unlock()
+
+	if logger != nil {
+		logger.Log(context.Background(), level, msg, args...)
+	}
+}
+
+// redactor returns a function removing all credentials from a string.
+// The lock must be held by the caller.
+func (bridge *Bridge) redactor() func(string) string {
+	var secrets []string
+	for _, secret := range []string{bridge.Username, bridge.clientKey} {
+		if secret != "" {
+			secrets = append(secrets, secret, redacted)
+		}
+	}
+	replacer := strings.NewReplacer(secrets...)
+
+	return func(str string) string {
+		str = replacer.Replace(str)
+		str = whitelistKey.ReplaceAllString(str, `"`+redacted+`"$1`)
+		return credentialField.ReplaceAllString(str, `$1"`+redacted+`"`)
+	}
+}
+
+// stdLogger writes all messages using the standard logger of package log.
+type stdLogger struct{}
+
+func (stdLogger) Log(ctx context.Context, level slog.Level, msg string, args ...interface{}) {
+	var attrs []string
+	for i := 0; i+1 < len(args); i += 2 {
+		attrs = append(attrs, fmt.Sprintf("%v=%v", args[i], args[i+1]))
+	}
+	log.Printf("%s %s %s\n", level, msg, strings.Join(attrs, " "))
+}
@@ -0,0 +1,251 @@
+package hue
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+const mdnsTimeout = 3 * time.Second
+
+// Service announced by hue bridges via mDNS
+// (see https://developers.meethue.com/develop/application-design-guidance/hue-bridge-discovery/)
+const mdnsService = "_hue._tcp.local."
+
+// DNS record types and classes used by mDNS discovery.
+const (
+	dnsTypeA   = 1
+	dnsTypePTR = 12
+	dnsTypeTXT = 16
+	dnsTypeSRV = 33
+	dnsClassIN = 1
+)
+
+// mdnsBridge contains all information a bridge announces via mDNS.
+type mdnsBridge struct {
+	IPAddr   string
+	BridgeID string
+	ModelID  string
+}
+
+// dnsRecord is a resource record of a DNS message. The data offset points
+// into the complete message, as names in the data may be compressed.
+type dnsRecord struct {
+	name   string
+	rrtype uint16
+	offset int
+	length int
+}
+
+// mdnsDiscover queries the local network for hue bridges until the context is done.
+// The query is sent from an ephemeral port, so responders answer with a
+// unicast response (RFC 6762, section 6.7) and port 5353 can stay in use by
+// the mDNS responder of the operating system.
+func mdnsDiscover(ctx context.Context, respondingHosts chan<- DiscoveredHost) error {
+	socket, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return err
+	}
+	defer socket.Close()
+	closeOnDone(ctx, socket)
+
+	_, err = socket.WriteToUDP(mdnsQuery(mdnsService), &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353})
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for {
+		buf := make([]byte, 9000)
+		n, addr, err := socket.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil // discovery done
+			}
+			if e, ok := err.(net.Error); !ok || !e.Timeout() {
+				return err //legitimate error, not a timeout.
+			}
+			return nil // timeout
+		}
+
+		found, err := parseMDNSResponse(buf[:n], addr.IP)
+		if err != nil {
+			continue // Ignore response
+		}
+		for _, bridge := range found {
+			if seen[bridge.IPAddr] {
+				continue
+			}
+			seen[bridge.IPAddr] = true
+			select {
+			case respondingHosts <- DiscoveredHost{Host: bridge.IPAddr, BridgeID: bridge.BridgeID, ModelID: bridge.ModelID}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// mdnsQuery builds a DNS message asking for all instances of the given service.
+func mdnsQuery(service string) []byte {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[4:], 1) // one question
+	for _, label := range strings.Split(strings.TrimSuffix(service, "."), ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	return append(msg, 0, 0, dnsTypePTR, 0, dnsClassIN)
+}
+
+// parseMDNSResponse extracts all announced bridges from a DNS message.
+// If the response contains no address records, the origin is used.
+func parseMDNSResponse(msg []byte, origin net.IP) ([]mdnsBridge, error) {
+	records, err := parseDNSMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []string
+	targets := make(map[string]string)
+	txts := make(map[string]map[string]string)
+	addresses := make(map[string]string)
+	for _, record := range records {
+		data := msg[record.offset : record.offset+record.length]
+		switch record.rrtype {
+		case dnsTypePTR:
+			if record.name == mdnsService {
+				instance, _, err := readDNSName(msg, record.offset)
+				if err == nil {
+					instances = append(instances, instance)
+				}
+			}
+		case dnsTypeSRV:
+			if record.length > 6 {
+				target, _, err := readDNSName(msg, record.offset+6)
+				if err == nil {
+					targets[record.name] = target
+				}
+			}
+		case dnsTypeTXT:
+			txts[record.name] = parseTXT(data)
+		case dnsTypeA:
+			if record.length == net.IPv4len {
+				addresses[record.name] = net.IP(data).String()
+			}
+		}
+	}
+	if len(instances) == 0 {
+		return nil, errors.New("Response contains no hue bridge")
+	}
+
+	var bridges []mdnsBridge
+	for _, instance := range instances {
+		bridge := mdnsBridge{IPAddr: origin.String()}
+		if address, ok := addresses[targets[instance]]; ok {
+			bridge.IPAddr = address
+		}
+		if txt, ok := txts[instance]; ok {
+			bridge.BridgeID = strings.ToUpper(txt["bridgeid"])
+			bridge.ModelID = txt["modelid"]
+		}
+		bridges = append(bridges, bridge)
+	}
+	return bridges, nil
+}
+
+// parseDNSMessage returns all answer, authority and additional records of the given message.
+func parseDNSMessage(msg []byte) ([]dnsRecord, error) {
+	if len(msg) < 12 {
+		return nil, errors.New("DNS message too short")
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	count := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:])) + int(binary.BigEndian.Uint16(msg[10:]))
+
+	offset := 12
+	for i := 0; i < questions; i++ {
+		_, next, err := readDNSName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = next + 4 // type and class
+	}
+
+	var records []dnsRecord
+	for i := 0; i < count; i++ {
+		name, next, err := readDNSName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(msg) {
+			return nil, errors.New("DNS record too short")
+		}
+		record := dnsRecord{
+			name:   name,
+			rrtype: binary.BigEndian.Uint16(msg[next:]),
+			offset: next + 10,
+			length: int(binary.BigEndian.Uint16(msg[next+8:])),
+		}
+		if record.offset+record.length > len(msg) {
+			return nil, errors.New("DNS record data too short")
+		}
+		records = append(records, record)
+		offset = record.offset + record.length
+	}
+	return records, nil
+}
+
+// readDNSName reads a (possibly compressed) name starting at the given offset.
+// Returns the lower case name and the offset following it.
+func readDNSName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if offset >= len(msg) {
+			return "", 0, errors.New("DNS name exceeds message")
+		}
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			if end < 0 {
+				end = offset + 1
+			}
+			return strings.ToLower(strings.Join(labels, ".")) + ".", end, nil
+		case length&0xC0 == 0xC0:
+			if offset+1 >= len(msg) || jumps > 10 {
+				return "", 0, errors.New("Invalid DNS name compression")
+			}
+			if end < 0 {
+				end = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3FFF)
+			jumps++
+		default:
+			offset++
+			if offset+length > len(msg) {
+				return "", 0, errors.New("DNS label exceeds message")
+			}
+			labels = append(labels, string(msg[offset:offset+length]))
+			offset += length
+		}
+	}
+}
+
+// parseTXT returns the key value pairs of a TXT record.
+func parseTXT(data []byte) map[string]string {
+	values := make(map[string]string)
+	for len(data) > 0 {
+		length := int(data[0])
+		if 1+length > len(data) {
+			break
+		}
+		pair := strings.SplitN(string(data[1:1+length]), "=", 2)
+		if len(pair) == 2 {
+			values[strings.ToLower(pair[0])] = pair[1]
+		}
+		data = data[1+length:]
+	}
+	return values
+}
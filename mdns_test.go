@@ -0,0 +1,141 @@
+package hue
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+// Response of a hue bridge to an mDNS query for _hue._tcp.local. The SRV,
+// TXT and A records use compressed names.
+var mdnsBridgeResponse = []byte{
+	0x00, 0x00, 0x84, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x03,
+	0x04, 0x5f, 0x68, 0x75, 0x65, 0x04, 0x5f, 0x74, 0x63, 0x70, 0x05, 0x6c,
+	0x6f, 0x63, 0x61, 0x6c, 0x00, 0x00, 0x0c, 0x00, 0x01, 0x00, 0x00, 0x11,
+	0x94, 0x00, 0x16, 0x13, 0x48, 0x75, 0x65, 0x20, 0x42, 0x72, 0x69, 0x64,
+	0x67, 0x65, 0x20, 0x2d, 0x20, 0x30, 0x39, 0x41, 0x32, 0x30, 0x36, 0xc0,
+	0x0c, 0xc0, 0x27, 0x00, 0x21, 0x80, 0x01, 0x00, 0x00, 0x00, 0x78, 0x00,
+	0x19, 0x00, 0x00, 0x00, 0x00, 0x01, 0xbb, 0x10, 0x30, 0x30, 0x31, 0x37,
+	0x38, 0x38, 0x46, 0x46, 0x46, 0x45, 0x30, 0x39, 0x41, 0x32, 0x30, 0x36,
+	0xc0, 0x16, 0xc0, 0x27, 0x00, 0x10, 0x80, 0x01, 0x00, 0x00, 0x11, 0x94,
+	0x00, 0x29, 0x19, 0x62, 0x72, 0x69, 0x64, 0x67, 0x65, 0x69, 0x64, 0x3d,
+	0x30, 0x30, 0x31, 0x37, 0x38, 0x38, 0x66, 0x66, 0x66, 0x65, 0x30, 0x39,
+	0x61, 0x32, 0x30, 0x36, 0x0e, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x69, 0x64,
+	0x3d, 0x42, 0x53, 0x42, 0x30, 0x30, 0x32, 0xc0, 0x4f, 0x00, 0x01, 0x80,
+	0x01, 0x00, 0x00, 0x00, 0x78, 0x00, 0x04, 0xc0, 0xa8, 0x01, 0x14,
+}
+
+// withoutAddress returns the bridge response without its A record.
+func withoutAddress() []byte {
+	msg := append([]byte{}, mdnsBridgeResponse[:len(mdnsBridgeResponse)-16]...)
+	msg[11] = 2 // additional records
+	return msg
+}
+
+func TestParseMDNSResponse(t *testing.T) {
+	origin := net.IPv4(192, 168, 1, 99)
+	tests := []struct {
+		name    string
+		msg     []byte
+		bridges []mdnsBridge
+		wantErr bool
+	}{
+		{"bridge", mdnsBridgeResponse, []mdnsBridge{{IPAddr: "192.168.1.20", BridgeID: "001788FFFE09A206", ModelID: "BSB002"}}, false},
+		{"without address record", withoutAddress(), []mdnsBridge{{IPAddr: "192.168.1.99", BridgeID: "001788FFFE09A206", ModelID: "BSB002"}}, false},
+		{"query", mdnsQuery(mdnsService), nil, true},
+		{"other service", mdnsQuery("_airplay._tcp.local."), nil, true},
+		{"empty", []byte{}, nil, true},
+		{"truncated header", mdnsBridgeResponse[:11], nil, true},
+		{"truncated name", mdnsBridgeResponse[:20], nil, true},
+		{"truncated record header", mdnsBridgeResponse[:35], nil, true},
+		{"truncated record data", mdnsBridgeResponse[:50], nil, true},
+		{"truncated compression pointer", mdnsBridgeResponse[:60], nil, true},
+		{"missing record", mdnsBridgeResponse[:len(mdnsBridgeResponse)-1], nil, true},
+		{"looping compression pointer", []byte{
+			0x00, 0x00, 0x84, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+			0xc0, 0x0c, 0x00, 0x0c, 0x00, 0x01, 0x00, 0x00, 0x11, 0x94, 0x00, 0x00,
+		}, nil, true},
+		{"alternating compression pointers", []byte{
+			0x00, 0x00, 0x84, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+			0x01, 0x61, 0xc0, 0x10, 0x01, 0x62, 0xc0, 0x0c,
+			0x00, 0x0c, 0x00, 0x01, 0x00, 0x00, 0x11, 0x94, 0x00, 0x00,
+		}, nil, true},
+		{"pointer beyond message", []byte{
+			0x00, 0x00, 0x84, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+			0xc0, 0xff, 0x00, 0x0c, 0x00, 0x01, 0x00, 0x00, 0x11, 0x94, 0x00, 0x00,
+		}, nil, true},
+	}
+
+	for _, test := range tests {
+		bridges, err := parseMDNSResponse(test.msg, origin)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(bridges, test.bridges) {
+			t.Errorf("%s: got %+v, want %+v", test.name, bridges, test.bridges)
+		}
+	}
+}
+
+func TestReadDNSName(t *testing.T) {
+	tests := []struct {
+		name    string
+		offset  int
+		dnsName string
+		end     int
+	}{
+		{"uncompressed", 12, "_hue._tcp.local.", 29},
+		{"label followed by pointer", 39, "hue bridge - 09a206._hue._tcp.local.", 61},
+		{"pointer", 61, "hue bridge - 09a206._hue._tcp.local.", 63},
+		{"host name", 79, "001788fffe09a206.local.", 98},
+		{"pointer to label followed by pointer", 151, "001788fffe09a206.local.", 153},
+	}
+
+	for _, test := range tests {
+		dnsName, end, err := readDNSName(mdnsBridgeResponse, test.offset)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if dnsName != test.dnsName || end != test.end {
+			t.Errorf("%s: got %q ending at %d, want %q ending at %d", test.name, dnsName, end, test.dnsName, test.end)
+		}
+	}
+}
+
+func TestParseDNSMessage(t *testing.T) {
+	records, err := parseDNSMessage(mdnsBridgeResponse)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var types []uint16
+	for _, record := range records {
+		types = append(types, record.rrtype)
+	}
+	want := []uint16{dnsTypePTR, dnsTypeSRV, dnsTypeTXT, dnsTypeA}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("got record types %v, want %v", types, want)
+	}
+}
+
+func TestParseTXT(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		values map[string]string
+	}{
+		{"pairs", []byte("\x0fBridgeID=00abcd\x0emodelid=BSB002"), map[string]string{"bridgeid": "00abcd", "modelid": "BSB002"}},
+		{"without value", []byte("\x04flag\x0emodelid=BSB002"), map[string]string{"modelid": "BSB002"}},
+		{"truncated", []byte("\x0emodelid=BSB002\x10bridgeid"), map[string]string{"modelid": "BSB002"}},
+		{"empty", nil, map[string]string{}},
+	}
+
+	for _, test := range tests {
+		values := parseTXT(test.data)
+		if !reflect.DeepEqual(values, test.values) {
+			t.Errorf("%s: got %v, want %v", test.name, values, test.values)
+		}
+	}
+}
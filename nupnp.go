@@ -1,17 +1,23 @@
 package hue
 
+import "context"
 import "encoding/json"
 import "net/http"
+import "strings"
 
 const nupnpEndpoint = "https://discovery.meethue.com/"
 
 type nupnpBridge struct {
-	Serial string `json:"id"`
+	ID     string `json:"id"`
 	IPAddr string `json:"internalipaddress"`
 }
 
-func nupnpDiscover(respondingHosts chan<- string) error {
-	response, err := http.Get(nupnpEndpoint)
+func nupnpDiscover(ctx context.Context, respondingHosts chan<- DiscoveredHost) error {
+	request, err := http.NewRequest("GET", nupnpEndpoint, nil)
+	if err != nil {
+		return err
+	}
+	response, err := http.DefaultClient.Do(request.WithContext(ctx))
 	if err != nil {
 		return err
 	}
@@ -24,7 +30,11 @@ func nupnpDiscover(respondingHosts chan<- string) error {
 	}
 
 	for _, bridge := range bridges {
-		respondingHosts <- bridge.IPAddr
+		select {
+		case respondingHosts <- DiscoveredHost{Host: bridge.IPAddr, BridgeID: strings.ToUpper(bridge.ID)}:
+		case <-ctx.Done():
+			return nil
+		}
 	}
 	return nil
 }
@@ -0,0 +1,857 @@
+package hue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DesiredState describes the intended configuration of a bridge. All resources
+// are identified by name. Lights are referenced by their names and addresses
+// or scene references may use names in braces instead of IDs, e.g.
+// /groups/{Kitchen}/action or {"scene": "{Relax}"}.
+type DesiredState struct {
+	Rooms     []DesiredGroup    `json:"rooms,omitempty"`
+	Zones     []DesiredGroup    `json:"zones,omitempty"`
+	Scenes    []DesiredScene    `json:"scenes,omitempty"`
+	Rules     []DesiredRule     `json:"rules,omitempty"`
+	Schedules []DesiredSchedule `json:"schedules,omitempty"`
+	Sensors   []DesiredSensor   `json:"sensors,omitempty"`
+
+	// Prune deletes all resources which aren't part of the desired state.
+	// Only kinds with at least one desired resource are pruned.
+	Prune bool `json:"prune,omitempty"`
+}
+
+// DesiredGroup describes a room or zone.
+type DesiredGroup struct {
+	Name   string   `json:"name"`
+	Class  string   `json:"class,omitempty"`
+	Lights []string `json:"lights"`
+}
+
+// DesiredScene describes a scene with explicit light states keyed by light name.
+// If Group is set, a GroupScene for the room or zone with this name is created.
+// Scenes are identified by name and group, as several rooms usually contain a
+// scene with the same name.
+type DesiredScene struct {
+	Name   string                      `json:"name"`
+	Group  string                      `json:"group,omitempty"`
+	Lights map[string]ModifyLightState `json:"lights"`
+}
+
+// DesiredRule describes a rule.
+type DesiredRule struct {
+	Name       string          `json:"name"`
+	Status     string          `json:"status,omitempty"`
+	Conditions []RuleCondition `json:"conditions"`
+	Actions    []RuleAction    `json:"actions"`
+}
+
+// DesiredSchedule describes a schedule. The command address may omit the
+// /api/<username> prefix.
+type DesiredSchedule struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	LocalTime   string          `json:"localtime"`
+	Status      string          `json:"status,omitempty"`
+	Command     ScheduleCommand `json:"command"`
+}
+
+// DesiredSensor describes the configuration of an existing sensor.
+// Only the given configuration attributes are compared and changed.
+type DesiredSensor struct {
+	Name   string                 `json:"name"`
+	Config map[string]interface{} `json:"config"`
+}
+
+// Operations of a PlanAction.
+const (
+	PlanCreate = "create"
+	PlanUpdate = "update"
+	PlanDelete = "delete"
+)
+
+// PlanAction describes a single change necessary to reach the desired state.
+type PlanAction struct {
+	Op   string
+	Kind string
+	Name string
+	Id   string
+	// Changes describes all differing attributes of an update.
+	Changes []string
+	apply   func() error
+}
+
+// Plan contains all changes necessary to reach a desired state. Use String
+// for a dry-run output and Apply to execute the changes.
+type Plan struct {
+	Actions    []PlanAction
+	reconciler *reconciler
+}
+
+// ReadDesiredState decodes a desired state from the given JSON document.
+func ReadDesiredState(r io.Reader) (*DesiredState, error) {
+	var desired DesiredState
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&desired)
+	if err != nil {
+		return nil, err
+	}
+	return &desired, nil
+}
+
+// Plan compares the desired state with the current state of the bridge and
+// returns all changes necessary to reach it.
+func (bridge *Bridge) Plan(desired *DesiredState) (*Plan, error) {
+	rec := &reconciler{bridge: bridge, ids: make(map[string]map[string]string), creates: make(map[string]map[string]bool)}
+	err := rec.load()
+	if err != nil {
+		return nil, err
+	}
+	rec.planning = true
+	defer func() { rec.planning = false }()
+	err = rec.markCreates(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{reconciler: rec}
+	var deletes []PlanAction
+	steps := []func(*DesiredState) ([]PlanAction, []PlanAction, error){rec.planGroups, rec.planSensors, rec.planScenes, rec.planSchedules, rec.planRules}
+	for _, step := range steps {
+		changes, removals, err := step(desired)
+		if err != nil {
+			return nil, err
+		}
+		plan.Actions = append(plan.Actions, changes...)
+		// Delete dependent resources first
+		deletes = append(removals, deletes...)
+	}
+	plan.Actions = append(plan.Actions, deletes...)
+
+	return plan, nil
+}
+
+// Empty reports whether the bridge already is in the desired state.
+func (plan *Plan) Empty() bool {
+	return len(plan.Actions) == 0
+}
+
+// String returns a human readable description of all planned changes.
+func (plan *Plan) String() string {
+	if plan.Empty() {
+		return "No changes.\n"
+	}
+
+	var buf bytes.Buffer
+	symbols := map[string]string{PlanCreate: "+", PlanUpdate: "~", PlanDelete: "-"}
+	for _, action := range plan.Actions {
+		fmt.Fprintf(&buf, "%s %s %s %q\n", symbols[action.Op], action.Op, action.Kind, action.Name)
+		for _, change := range action.Changes {
+			fmt.Fprintf(&buf, "    %s\n", change)
+		}
+	}
+	return buf.String()
+}
+
+// Apply executes all planned changes in order. It stops at the first failing change.
+func (plan *Plan) Apply() error {
+	for _, action := range plan.Actions {
+		err := action.apply()
+		if err != nil {
+			return fmt.Errorf("Unable to %s %s %q: %v", action.Op, action.Kind, action.Name, err)
+		}
+	}
+	return nil
+}
+
+type reconciler struct {
+	bridge    *Bridge
+	ids       map[string]map[string]string // resource kind -> name -> ID
+	creates   map[string]map[string]bool   // resource kind -> names created by the plan
+	planning  bool
+	groups    map[string]*Group
+	scenes    map[sceneKey][]*Scene
+	sceneKeys map[string]map[sceneKey]bool // scene name -> existing and desired scenes
+	sensors   map[string]*Sensor
+	rules     map[string]*Rule
+	schedules map[string]*Schedule
+}
+
+// load reads the current state of the bridge.
+func (rec *reconciler) load() error {
+	lights, err := rec.bridge.GetAllLights()
+	if err != nil {
+		return err
+	}
+	for _, light := range lights {
+		rec.setID("lights", light.Name, light.Id)
+	}
+
+	groups, err := rec.bridge.AllGroups()
+	if err != nil {
+		return err
+	}
+	rec.groups = make(map[string]*Group)
+	for _, group := range groups {
+		rec.groups[group.Name] = group
+		rec.setID("groups", group.Name, group.Id)
+	}
+
+	scenes, err := rec.bridge.AllScenes()
+	if err != nil {
+		return err
+	}
+	rec.scenes = make(map[sceneKey][]*Scene)
+	rec.sceneKeys = make(map[string]map[sceneKey]bool)
+	for _, scene := range scenes {
+		// Ignore scenes automatically created and cleaned up by apps
+		if scene.Recycle {
+			continue
+		}
+		key := sceneKey{name: scene.Name}
+		if scene.Type == GroupScene {
+			key.group = scene.Group
+		}
+		rec.scenes[key] = append(rec.scenes[key], scene)
+		rec.addSceneKey(key)
+		rec.setID("scenes", scene.Name, scene.Id)
+	}
+
+	sensors, err := rec.bridge.AllSensors()
+	if err != nil {
+		return err
+	}
+	rec.sensors = make(map[string]*Sensor)
+	for _, sensor := range sensors {
+		rec.sensors[sensor.Name] = sensor
+		rec.setID("sensors", sensor.Name, sensor.Id)
+	}
+
+	rules, err := rec.bridge.AllRules()
+	if err != nil {
+		return err
+	}
+	rec.rules = make(map[string]*Rule)
+	for _, rule := range rules {
+		rec.rules[rule.Name] = rule
+		rec.setID("rules", rule.Name, rule.Id)
+	}
+
+	schedules, err := rec.bridge.AllSchedules()
+	if err != nil {
+		return err
+	}
+	rec.schedules = make(map[string]*Schedule)
+	for _, schedule := range schedules {
+		rec.schedules[schedule.Name] = schedule
+		rec.setID("schedules", schedule.Name, schedule.Id)
+	}
+
+	return nil
+}
+
+// sceneKey identifies a scene. Scene names are only unique per group, e.g.
+// the official app creates a scene "Relax" for every room.
+type sceneKey struct {
+	name  string
+	group string // group ID of a GroupScene, empty for a LightScene
+}
+
+func (rec *reconciler) addSceneKey(key sceneKey) {
+	if rec.sceneKeys[key.name] == nil {
+		rec.sceneKeys[key.name] = make(map[sceneKey]bool)
+	}
+	rec.sceneKeys[key.name][key] = true
+}
+
+// desiredSceneKey returns the key of the given desired scene.
+func (rec *reconciler) desiredSceneKey(desiredScene DesiredScene) (sceneKey, error) {
+	key := sceneKey{name: desiredScene.Name}
+	if desiredScene.Group == "" {
+		return key, nil
+	}
+	var err error
+	key.group, err = rec.resolve("groups", desiredScene.Group)
+	return key, err
+}
+
+// markCreates records all resources the plan will create. References to
+// them can only be resolved once the plan is applied.
+func (rec *reconciler) markCreates(desired *DesiredState) error {
+	mark := func(kind, name string) {
+		if _, ok := rec.ids[kind][name]; ok && kind != "scenes" {
+			return
+		}
+		if rec.creates[kind] == nil {
+			rec.creates[kind] = make(map[string]bool)
+		}
+		rec.creates[kind][name] = true
+	}
+	for _, group := range desired.Rooms {
+		mark("groups", group.Name)
+	}
+	for _, group := range desired.Zones {
+		mark("groups", group.Name)
+	}
+	for _, schedule := range desired.Schedules {
+		mark("schedules", schedule.Name)
+	}
+	for _, rule := range desired.Rules {
+		mark("rules", rule.Name)
+	}
+
+	desiredScenes := make(map[sceneKey]bool)
+	for _, desiredScene := range desired.Scenes {
+		key, err := rec.desiredSceneKey(desiredScene)
+		if err != nil {
+			return err
+		}
+		if desiredScenes[key] {
+			return fmt.Errorf("Scene %s is defined twice", describeScene(desiredScene.Name, desiredScene.Group))
+		}
+		desiredScenes[key] = true
+		rec.addSceneKey(key)
+		if len(rec.scenes[key]) == 0 {
+			mark("scenes", desiredScene.Name)
+		}
+	}
+	return nil
+}
+
+func (rec *reconciler) planGroups(desired *DesiredState) ([]PlanAction, []PlanAction, error) {
+	var changes, deletes []PlanAction
+	for _, kind := range []struct {
+		groupType string
+		desired   []DesiredGroup
+	}{{"Room", desired.Rooms}, {"Zone", desired.Zones}} {
+		kindName := strings.ToLower(kind.groupType)
+		wanted := make(map[string]bool)
+
+		for _, desiredGroup := range kind.desired {
+			desiredGroup := desiredGroup
+			groupType := kind.groupType
+			wanted[desiredGroup.Name] = true
+			lights := func() ([]string, error) { return rec.resolveAll("lights", desiredGroup.Lights) }
+			lightIDs, err := lights()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			group, ok := rec.groups[desiredGroup.Name]
+			if !ok || group.Type != groupType {
+				changes = append(changes, PlanAction{Op: PlanCreate, Kind: kindName, Name: desiredGroup.Name, apply: func() error {
+					lightIDs, err := lights()
+					if err != nil {
+						return err
+					}
+					results, err := rec.bridge.CreateGroup(CreateGroup{Name: desiredGroup.Name, Type: groupType, Class: desiredGroup.Class, Lights: lightIDs})
+					return rec.created("groups", desiredGroup.Name, results, err)
+				}})
+				continue
+			}
+
+			var diff []string
+			if desiredGroup.Class != "" && desiredGroup.Class != group.Class {
+				diff = append(diff, describeChange("class", group.Class, desiredGroup.Class))
+			}
+			if !sameLights(group.Lights, sortedCopy(lightIDs)) {
+				diff = append(diff, describeChange("lights", rec.names("lights", group.Lights), desiredGroup.Lights))
+			}
+			if len(diff) > 0 {
+				changes = append(changes, PlanAction{Op: PlanUpdate, Kind: kindName, Name: group.Name, Id: group.Id, Changes: diff, apply: func() error {
+					lightIDs, err := lights()
+					if err != nil {
+						return err
+					}
+					results, err := group.Modify(ModifyGroup{Class: desiredGroup.Class, Lights: lightIDs})
+					return checkResults(results, err)
+				}})
+			}
+		}
+
+		if desired.Prune && len(kind.desired) > 0 {
+			for _, name := range sortedNames(rec.groups) {
+				group := rec.groups[name]
+				if group.Type == kind.groupType && !wanted[name] {
+					deletes = append(deletes, PlanAction{Op: PlanDelete, Kind: kindName, Name: name, Id: group.Id, apply: func() error {
+						return checkResults(group.Delete())
+					}})
+				}
+			}
+		}
+	}
+	return changes, deletes, nil
+}
+
+func (rec *reconciler) planSensors(desired *DesiredState) ([]PlanAction, []PlanAction, error) {
+	var changes []PlanAction
+	for _, desiredSensor := range desired.Sensors {
+		sensor, ok := rec.sensors[desiredSensor.Name]
+		if !ok {
+			return nil, nil, fmt.Errorf("Unable to find sensor with name %s", desiredSensor.Name)
+		}
+
+		config := make(map[string]interface{})
+		var diff []string
+		for _, key := range sortedNames(desiredSensor.Config) {
+			if jsonString(sensor.Config[key]) != jsonString(desiredSensor.Config[key]) {
+				config[key] = desiredSensor.Config[key]
+				diff = append(diff, describeChange("config."+key, sensor.Config[key], desiredSensor.Config[key]))
+			}
+		}
+		if len(diff) > 0 {
+			changes = append(changes, PlanAction{Op: PlanUpdate, Kind: "sensor", Name: sensor.Name, Id: sensor.Id, Changes: diff, apply: func() error {
+				return checkResults(sensor.ModifyConfig(config))
+			}})
+		}
+	}
+	return changes, nil, nil
+}
+
+func (rec *reconciler) planScenes(desired *DesiredState) ([]PlanAction, []PlanAction, error) {
+	var changes, deletes []PlanAction
+	wanted := make(map[sceneKey]bool)
+
+	for _, desiredScene := range desired.Scenes {
+		desiredScene := desiredScene
+		lightstates := func() (map[string]ModifyLightState, error) {
+			result := make(map[string]ModifyLightState)
+			for name, lightstate := range desiredScene.Lights {
+				lightID, err := rec.resolve("lights", name)
+				if err != nil {
+					return nil, err
+				}
+				result[lightID] = lightstate
+			}
+			return result, nil
+		}
+		create := func() error {
+			states, err := lightstates()
+			if err != nil {
+				return err
+			}
+			scenedata := CreateScene{Name: desiredScene.Name, Type: LightScene, LightStates: states}
+			if desiredScene.Group != "" {
+				scenedata.Type = GroupScene
+				scenedata.Group, err = rec.resolve("groups", desiredScene.Group)
+				if err != nil {
+					return err
+				}
+			}
+			results, err := rec.bridge.CreateScene(scenedata)
+			return rec.created("scenes", desiredScene.Name, results, err)
+		}
+
+		states, err := lightstates()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := rec.desiredSceneKey(desiredScene)
+		if err != nil {
+			return nil, nil, err
+		}
+		wanted[key] = true
+
+		// A scene with another type or group is a different scene
+		existing := rec.scenes[key]
+		if len(existing) > 1 {
+			return nil, nil, fmt.Errorf("Scene %s is ambiguous, %d scenes with this name exist", describeScene(desiredScene.Name, desiredScene.Group), len(existing))
+		}
+		if len(existing) == 0 {
+			changes = append(changes, PlanAction{Op: PlanCreate, Kind: "scene", Name: desiredScene.Name, apply: create})
+			continue
+		}
+		scene := existing[0]
+		// Light states are read as stored, so zero values like hue 0 are compared
+		stored, err := rec.bridge.storedSceneByID(scene.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var diff []string
+		for _, lightName := range sortedNames(desiredScene.Lights) {
+			lightID, err := rec.resolve("lights", lightName)
+			if err != nil {
+				return nil, nil, err
+			}
+			current, ok := stored.LightStates[lightID]
+			if !ok {
+				diff = append(diff, describeChange("lights."+lightName, nil, desiredScene.Lights[lightName]))
+				continue
+			}
+			if subsetDiffers(states[lightID], current) {
+				diff = append(diff, describeChange("lights."+lightName, current, desiredScene.Lights[lightName]))
+			}
+		}
+		if len(diff) > 0 {
+			changes = append(changes, PlanAction{Op: PlanUpdate, Kind: "scene", Name: scene.Name, Id: scene.Id, Changes: diff, apply: func() error {
+				states, err := lightstates()
+				if err != nil {
+					return err
+				}
+				modify := ModifyScene{LightStates: states}
+				if stored.Type != GroupScene {
+					for lightID := range states {
+						modify.Lights = append(modify.Lights, lightID)
+					}
+					sort.Strings(modify.Lights)
+				}
+				return checkResults(stored.Modify(modify))
+			}})
+		}
+	}
+
+	if desired.Prune && len(desired.Scenes) > 0 {
+		var unwanted []*Scene
+		for key, scenes := range rec.scenes {
+			if !wanted[key] {
+				unwanted = append(unwanted, scenes...)
+			}
+		}
+		sort.Slice(unwanted, func(i, j int) bool {
+			if unwanted[i].Name != unwanted[j].Name {
+				return unwanted[i].Name < unwanted[j].Name
+			}
+			return unwanted[i].Id < unwanted[j].Id
+		})
+		for _, scene := range unwanted {
+			scene := scene
+			// Locked scenes are still referenced by rules or schedules
+			if !scene.Locked {
+				deletes = append(deletes, PlanAction{Op: PlanDelete, Kind: "scene", Name: scene.Name, Id: scene.Id, apply: func() error {
+					return checkResults(scene.Delete())
+				}})
+			}
+		}
+	}
+	return changes, deletes, nil
+}
+
+func (rec *reconciler) planSchedules(desired *DesiredState) ([]PlanAction, []PlanAction, error) {
+	var changes, deletes []PlanAction
+	wanted := make(map[string]bool)
+
+	for _, desiredSchedule := range desired.Schedules {
+		desiredSchedule := desiredSchedule
+		wanted[desiredSchedule.Name] = true
+		command := func() (ScheduleCommand, error) {
+			resolved := desiredSchedule.Command
+			address, err := rec.resolveAddress(resolved.Address)
+			if err != nil {
+				return resolved, err
+			}
+			if !strings.HasPrefix(address, "/api/") {
+				address = "/api/" + rec.bridge.Username + address
+			}
+			resolved.Address = address
+			resolved.Body, err = rec.resolveBody(resolved.Body)
+			return resolved, err
+		}
+
+		resolved, err := command()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		schedule, ok := rec.schedules[desiredSchedule.Name]
+		if !ok {
+			changes = append(changes, PlanAction{Op: PlanCreate, Kind: "schedule", Name: desiredSchedule.Name, apply: func() error {
+				resolved, err := command()
+				if err != nil {
+					return err
+				}
+				results, err := rec.bridge.CreateSchedule(CreateSchedule{
+					Name:        desiredSchedule.Name,
+					Description: desiredSchedule.Description,
+					Command:     resolved,
+					LocalTime:   desiredSchedule.LocalTime,
+					Status:      desiredSchedule.Status,
+				})
+				return rec.created("schedules", desiredSchedule.Name, results, err)
+			}})
+			continue
+		}
+
+		var diff []string
+		if desiredSchedule.Description != schedule.Description {
+			diff = append(diff, describeChange("description", schedule.Description, desiredSchedule.Description))
+		}
+		if desiredSchedule.LocalTime != schedule.LocalTime {
+			diff = append(diff, describeChange("localtime", schedule.LocalTime, desiredSchedule.LocalTime))
+		}
+		if desiredSchedule.Status != "" && desiredSchedule.Status != schedule.Status {
+			diff = append(diff, describeChange("status", schedule.Status, desiredSchedule.Status))
+		}
+		if jsonString(resolved) != jsonString(schedule.Command) {
+			diff = append(diff, describeChange("command", schedule.Command, desiredSchedule.Command))
+		}
+		if len(diff) > 0 {
+			changes = append(changes, PlanAction{Op: PlanUpdate, Kind: "schedule", Name: schedule.Name, Id: schedule.Id, Changes: diff, apply: func() error {
+				resolved, err := command()
+				if err != nil {
+					return err
+				}
+				return checkResults(schedule.Modify(ModifySchedule{
+					Description: desiredSchedule.Description,
+					Command:     &resolved,
+					LocalTime:   desiredSchedule.LocalTime,
+					Status:      desiredSchedule.Status,
+				}))
+			}})
+		}
+	}
+
+	if desired.Prune && len(desired.Schedules) > 0 {
+		for _, name := range sortedNames(rec.schedules) {
+			schedule := rec.schedules[name]
+			if !wanted[name] {
+				deletes = append(deletes, PlanAction{Op: PlanDelete, Kind: "schedule", Name: name, Id: schedule.Id, apply: func() error {
+					return checkResults(schedule.Delete())
+				}})
+			}
+		}
+	}
+	return changes, deletes, nil
+}
+
+func (rec *reconciler) planRules(desired *DesiredState) ([]PlanAction, []PlanAction, error) {
+	var changes, deletes []PlanAction
+	wanted := make(map[string]bool)
+
+	for _, desiredRule := range desired.Rules {
+		desiredRule := desiredRule
+		wanted[desiredRule.Name] = true
+		resolve := func() ([]RuleCondition, []RuleAction, error) {
+			var conditions []RuleCondition
+			for _, condition := range desiredRule.Conditions {
+				address, err := rec.resolveAddress(condition.Address)
+				if err != nil {
+					return nil, nil, err
+				}
+				condition.Address = address
+				conditions = append(conditions, condition)
+			}
+			var actions []RuleAction
+			for _, action := range desiredRule.Actions {
+				address, err := rec.resolveAddress(action.Address)
+				if err != nil {
+					return nil, nil, err
+				}
+				action.Address = address
+				action.Body, err = rec.resolveBody(action.Body)
+				if err != nil {
+					return nil, nil, err
+				}
+				actions = append(actions, action)
+			}
+			return conditions, actions, nil
+		}
+
+		conditions, actions, err := resolve()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		rule, ok := rec.rules[desiredRule.Name]
+		if !ok {
+			changes = append(changes, PlanAction{Op: PlanCreate, Kind: "rule", Name: desiredRule.Name, apply: func() error {
+				conditions, actions, err := resolve()
+				if err != nil {
+					return err
+				}
+				results, err := rec.bridge.CreateRule(CreateRule{Name: desiredRule.Name, Status: desiredRule.Status, Conditions: conditions, Actions: actions})
+				return rec.created("rules", desiredRule.Name, results, err)
+			}})
+			continue
+		}
+
+		var diff []string
+		if desiredRule.Status != "" && desiredRule.Status != rule.Status {
+			diff = append(diff, describeChange("status", rule.Status, desiredRule.Status))
+		}
+		if jsonString(conditions) != jsonString(rule.Conditions) {
+			diff = append(diff, describeChange("conditions", rule.Conditions, desiredRule.Conditions))
+		}
+		if jsonString(actions) != jsonString(rule.Actions) {
+			diff = append(diff, describeChange("actions", rule.Actions, desiredRule.Actions))
+		}
+		if len(diff) > 0 {
+			changes = append(changes, PlanAction{Op: PlanUpdate, Kind: "rule", Name: rule.Name, Id: rule.Id, Changes: diff, apply: func() error {
+				conditions, actions, err := resolve()
+				if err != nil {
+					return err
+				}
+				return checkResults(rule.Modify(ModifyRule{Status: desiredRule.Status, Conditions: conditions, Actions: actions}))
+			}})
+		}
+	}
+
+	if desired.Prune && len(desired.Rules) > 0 {
+		for _, name := range sortedNames(rec.rules) {
+			rule := rec.rules[name]
+			if !wanted[name] {
+				deletes = append(deletes, PlanAction{Op: PlanDelete, Kind: "rule", Name: name, Id: rule.Id, apply: func() error {
+					return checkResults(rule.Delete())
+				}})
+			}
+		}
+	}
+	return changes, deletes, nil
+}
+
+func (rec *reconciler) setID(kind, name, id string) {
+	if rec.ids[kind] == nil {
+		rec.ids[kind] = make(map[string]string)
+	}
+	rec.ids[kind][name] = id
+}
+
+// resolve returns the ID of the resource with the given name. While planning,
+// resources created by the plan resolve to their reference, e.g. {Relax}.
+func (rec *reconciler) resolve(kind, name string) (string, error) {
+	if kind == "scenes" && len(rec.sceneKeys[name]) > 1 {
+		return "", fmt.Errorf("Scene name %s is ambiguous", name)
+	}
+	id, ok := rec.ids[kind][name]
+	if ok {
+		return id, nil
+	}
+	if rec.planning && rec.creates[kind][name] {
+		return "{" + name + "}", nil
+	}
+	return "", fmt.Errorf("Unable to find %s with name %s", strings.TrimSuffix(kind, "s"), name)
+}
+
+func (rec *reconciler) resolveAll(kind string, names []string) ([]string, error) {
+	ids := []string{}
+	for _, name := range names {
+		id, err := rec.resolve(kind, name)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// resolveAddress replaces a resource name in braces with its ID.
+func (rec *reconciler) resolveAddress(address string) (string, error) {
+	match := resourceAddress.FindStringSubmatch(address)
+	if match == nil || !isReference(match[3]) {
+		return address, nil
+	}
+	id, err := rec.resolve(match[2], strings.Trim(match[3], "{}"))
+	if err != nil {
+		return address, err
+	}
+	return fmt.Sprintf("%s/%s/%s%s", match[1], match[2], id, match[4]), nil
+}
+
+// resolveBody replaces a scene name in braces with its ID.
+func (rec *reconciler) resolveBody(body map[string]interface{}) (map[string]interface{}, error) {
+	scene, ok := body["scene"].(string)
+	if !ok || !isReference(scene) {
+		return body, nil
+	}
+	id, err := rec.resolve("scenes", strings.Trim(scene, "{}"))
+	if err != nil {
+		return body, err
+	}
+	resolved := withoutKeys(body)
+	resolved["scene"] = id
+	return resolved, nil
+}
+
+// name returns the name of the resource with the given ID.
+func (rec *reconciler) name(kind, id string) string {
+	for name, candidate := range rec.ids[kind] {
+		if candidate == id {
+			return name
+		}
+	}
+	return id
+}
+
+func (rec *reconciler) names(kind string, ids []string) []string {
+	var names []string
+	for _, id := range ids {
+		names = append(names, rec.name(kind, id))
+	}
+	return names
+}
+
+// created records the ID of a newly created resource, so later changes can reference it.
+func (rec *reconciler) created(kind, name string, results []Result, err error) error {
+	if err != nil {
+		return err
+	}
+	id, err := createdID(results)
+	if err != nil {
+		return err
+	}
+	rec.setID(kind, name, id)
+	return nil
+}
+
+// describeScene returns the name of a scene including its group, if any.
+func describeScene(name, group string) string {
+	if group == "" {
+		return name
+	}
+	return fmt.Sprintf("%s (group %s)", name, group)
+}
+
+func isReference(id string) bool {
+	return strings.HasPrefix(id, "{") && strings.HasSuffix(id, "}")
+}
+
+func checkResults(results []Result, err error) error {
+	if err != nil {
+		return err
+	}
+	return resultsError(results)
+}
+
+func describeChange(attribute string, from, to interface{}) string {
+	return fmt.Sprintf("%s: %s => %s", attribute, jsonString(from), jsonString(to))
+}
+
+func jsonString(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// subsetDiffers reports whether any attribute set in desired differs from current.
+func subsetDiffers(desired, current interface{}) bool {
+	var desiredAttributes, currentAttributes map[string]interface{}
+	json.Unmarshal([]byte(jsonString(desired)), &desiredAttributes)
+	json.Unmarshal([]byte(jsonString(current)), &currentAttributes)
+	for key, value := range desiredAttributes {
+		if jsonString(value) != jsonString(currentAttributes[key]) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedCopy(values []string) []string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// sortedNames returns the keys of the given map in alphabetical order.
+func sortedNames(resources interface{}) []string {
+	names := sortedIDs(resources)
+	sort.Strings(names)
+	return names
+}
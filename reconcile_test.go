@@ -0,0 +1,267 @@
+package hue
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeBridge stores scenes like a bridge, all other resources are fixed.
+type fakeBridge struct {
+	lock   sync.Mutex
+	lights map[string]interface{}
+	groups map[string]interface{}
+	scenes map[string]map[string]interface{}
+	nextID int
+}
+
+func newFakeBridge() *fakeBridge {
+	return &fakeBridge{
+		lights: map[string]interface{}{
+			"1": map[string]interface{}{"name": "Bed", "uniqueid": "00:17:88:01:00:00:00:01-0b"},
+			"2": map[string]interface{}{"name": "Desk", "uniqueid": "00:17:88:01:00:00:00:02-0b"},
+		},
+		groups: map[string]interface{}{
+			"1": map[string]interface{}{"name": "Bedroom", "type": "Room", "class": "Bedroom", "lights": []string{"1"}},
+			"2": map[string]interface{}{"name": "Office", "type": "Room", "class": "Office", "lights": []string{"2"}},
+		},
+		scenes: make(map[string]map[string]interface{}),
+	}
+}
+
+// addScene stores a scene with the given JSON attributes and returns its ID.
+func (fake *fakeBridge) addScene(attributes string) string {
+	var scene map[string]interface{}
+	err := json.Unmarshal([]byte(attributes), &scene)
+	if err != nil {
+		panic(err)
+	}
+	if _, ok := scene["lightstates"]; !ok {
+		scene["lightstates"] = map[string]interface{}{}
+	}
+	if scene["type"] == GroupScene {
+		group := fake.groups[scene["group"].(string)].(map[string]interface{})
+		scene["lights"] = group["lights"]
+	}
+	fake.nextID++
+	id := fmt.Sprintf("scene%d", fake.nextID)
+	fake.scenes[id] = scene
+	return id
+}
+
+func (fake *fakeBridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/testuser"), "/"), "/")
+	var response interface{}
+	switch {
+	case r.Method == "GET" && path[0] == "lights":
+		response = fake.lights
+	case r.Method == "GET" && path[0] == "groups":
+		response = fake.groups
+	case r.Method == "GET" && path[0] == "scenes" && len(path) == 1:
+		scenes := make(map[string]interface{})
+		for id, scene := range fake.scenes {
+			listed := make(map[string]interface{})
+			for key, value := range scene {
+				if key != "lightstates" {
+					listed[key] = value
+				}
+			}
+			scenes[id] = listed
+		}
+		response = scenes
+	case r.Method == "GET" && path[0] == "scenes":
+		response = fake.scenes[path[1]]
+	case r.Method == "POST" && path[0] == "scenes":
+		id := fake.addScene(string(body))
+		response = []Result{{Success: map[string]interface{}{"id": id}}}
+	case r.Method == "PUT" && path[0] == "scenes":
+		var changes map[string]interface{}
+		json.Unmarshal(body, &changes)
+		scene := fake.scenes[path[1]]
+		for key, value := range changes {
+			if key != "lightstates" {
+				scene[key] = value
+				continue
+			}
+			// Light states are replaced per light
+			for lightID, lightstate := range value.(map[string]interface{}) {
+				scene["lightstates"].(map[string]interface{})[lightID] = lightstate
+			}
+		}
+		response = []Result{{Success: map[string]interface{}{"/scenes/" + path[1]: "updated"}}}
+	case r.Method == "DELETE" && path[0] == "scenes":
+		delete(fake.scenes, path[1])
+		response = []Result{{Success: map[string]interface{}{"/scenes/" + path[1]: "deleted"}}}
+	case r.Method == "GET" && (path[0] == "sensors" || path[0] == "rules" || path[0] == "schedules"):
+		response = map[string]interface{}{}
+	default:
+		response = []Result{{Error: &ResultError{Type: 4, Address: r.URL.Path, Description: "method not available"}}}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// testPlan starts a fake bridge and returns a bridge talking to it.
+func testPlan(t *testing.T, fake *fakeBridge) *Bridge {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return NewBridge(strings.TrimPrefix(server.URL, "http://"), "testuser")
+}
+
+func readTestState(t *testing.T, document string) *DesiredState {
+	desired, err := ReadDesiredState(strings.NewReader(document))
+	if err != nil {
+		t.Fatalf("invalid desired state: %v", err)
+	}
+	return desired
+}
+
+func TestPlanStoredSceneUnchanged(t *testing.T) {
+	fake := newFakeBridge()
+	fake.addScene(`{"name": "Night", "type": "LightScene", "lights": ["1", "2"], "lightstates": {
+		"1": {"on": true, "bri": 100, "hue": 0, "sat": 0, "transitiontime": 4},
+		"2": {"on": false, "transitiontime": 0}}}`)
+	bridge := testPlan(t, fake)
+
+	desired := readTestState(t, `{"scenes": [{"name": "Night", "lights": {
+		"Bed": {"on": true, "bri": 100, "hue": 0, "sat": 0, "transitiontime": 4},
+		"Desk": {"on": false, "transitiontime": 0}}}]}`)
+	plan, err := bridge.Plan(desired)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !plan.Empty() {
+		t.Errorf("unexpected changes:\n%s", plan)
+	}
+}
+
+func TestPlanConverges(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		desired  string
+	}{
+		{"create", nil, `{"scenes": [
+			{"name": "Night", "lights": {
+				"Bed": {"on": true, "bri": 100, "hue": 0, "sat": 0, "transitiontime": 4},
+				"Desk": {"on": false}}},
+			{"name": "Relax", "group": "Bedroom", "lights": {"Bed": {"on": true, "bri": 144, "ct": 447}}}]}`},
+		{"update", []string{
+			`{"name": "Night", "type": "LightScene", "lights": ["1", "2"], "lightstates": {
+				"1": {"on": true, "bri": 254, "hue": 8000, "sat": 120},
+				"2": {"on": true, "bri": 10, "xy": [0.5, 0.4]}}}`,
+		}, `{"scenes": [{"name": "Night", "lights": {
+			"Bed": {"on": true, "bri": 100, "hue": 0, "sat": 0, "transitiontime": 0},
+			"Desk": {"on": false}}}]}`},
+		{"prune", []string{
+			`{"name": "Old", "type": "LightScene", "lights": ["1"], "lightstates": {"1": {"on": true, "bri": 1}}}`,
+		}, `{"prune": true, "scenes": [{"name": "Night", "lights": {"Bed": {"on": false}}}]}`},
+	}
+
+	for _, test := range tests {
+		fake := newFakeBridge()
+		for _, scene := range test.existing {
+			fake.addScene(scene)
+		}
+		bridge := testPlan(t, fake)
+		desired := readTestState(t, test.desired)
+
+		plan, err := bridge.Plan(desired)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if plan.Empty() {
+			t.Errorf("%s: plan has no changes", test.name)
+		}
+		err = plan.Apply()
+		if err != nil {
+			t.Errorf("%s: unable to apply plan: %v", test.name, err)
+			continue
+		}
+
+		plan, err = bridge.Plan(desired)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if !plan.Empty() {
+			t.Errorf("%s: changes after apply:\n%s", test.name, plan)
+		}
+	}
+}
+
+func TestPlanScenesPerGroup(t *testing.T) {
+	fake := newFakeBridge()
+	bedroom := fake.addScene(`{"name": "Relax", "type": "GroupScene", "group": "1", "lightstates": {"1": {"on": true, "bri": 144}}}`)
+	office := fake.addScene(`{"name": "Relax", "type": "GroupScene", "group": "2", "lightstates": {"2": {"on": true, "bri": 144}}}`)
+	bridge := testPlan(t, fake)
+
+	desired := readTestState(t, `{"prune": true, "scenes": [
+		{"name": "Relax", "group": "Bedroom", "lights": {"Bed": {"on": true, "bri": 50}}},
+		{"name": "Relax", "group": "Office", "lights": {"Desk": {"on": true, "bri": 144}}}]}`)
+	plan, err := bridge.Plan(desired)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(plan.Actions) != 1 || plan.Actions[0].Op != PlanUpdate || plan.Actions[0].Id != bedroom {
+		t.Fatalf("expected update of scene %s only, got:\n%s", bedroom, plan)
+	}
+	err = plan.Apply()
+	if err != nil {
+		t.Fatalf("unable to apply plan: %v", err)
+	}
+	if _, ok := fake.scenes[office]; !ok {
+		t.Errorf("scene %s of the office was deleted", office)
+	}
+
+	plan, err = bridge.Plan(desired)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !plan.Empty() {
+		t.Errorf("changes after apply:\n%s", plan)
+	}
+}
+
+func TestPlanAmbiguousScene(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		desired  string
+	}{
+		{"duplicate scenes", []string{
+			`{"name": "Relax", "type": "LightScene", "lights": ["1"], "lightstates": {"1": {"on": true}}}`,
+			`{"name": "Relax", "type": "LightScene", "lights": ["1"], "lightstates": {"1": {"on": false}}}`,
+		}, `{"scenes": [{"name": "Relax", "lights": {"Bed": {"on": true}}}]}`},
+		{"duplicate desired scenes", nil, `{"scenes": [
+			{"name": "Relax", "group": "Office", "lights": {"Desk": {"on": true}}},
+			{"name": "Relax", "group": "Office", "lights": {"Desk": {"on": false}}}]}`},
+		{"reference to scene of several groups", []string{
+			`{"name": "Relax", "type": "GroupScene", "group": "1", "lightstates": {"1": {"on": true}}}`,
+			`{"name": "Relax", "type": "GroupScene", "group": "2", "lightstates": {"2": {"on": true}}}`,
+		}, `{"schedules": [{"name": "Evening", "localtime": "W127/T20:00:00",
+			"command": {"address": "/groups/0/action", "method": "PUT", "body": {"scene": "{Relax}"}}}]}`},
+	}
+
+	for _, test := range tests {
+		fake := newFakeBridge()
+		for _, scene := range test.existing {
+			fake.addScene(scene)
+		}
+		bridge := testPlan(t, fake)
+
+		plan, err := bridge.Plan(readTestState(t, test.desired))
+		if err == nil {
+			t.Errorf("%s: expected error, got plan:\n%s", test.name, plan)
+		}
+	}
+}
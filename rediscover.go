@@ -0,0 +1,137 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+)
+
+// Maximum duration of a rediscovery after a connection failure.
+const rediscoveryTimeout = 15 * time.Second
+
+// AddressChange is reported when a bridge was found at a new address.
+type AddressChange struct {
+	BridgeID string
+	OldAddr  string
+	NewAddr  string
+}
+
+// EnableRediscovery remembers the ID of the bridge. Whenever the bridge can't
+// be reached, the local network is searched for the bridge with this ID. If it
+// is found at a new address, IpAddr is updated and the failed request is
+// retried. If bridgeID is empty, it is read from the bridge configuration,
+// which requires the bridge to be reachable. The optional onChange function
+// is called for every change of the address.
+func (bridge *Bridge) EnableRediscovery(bridgeID string, onChange func(AddressChange)) error {
+	if bridgeID == "" {
+		var config Configuration
+		err := bridge.do("GET", hostURL("http", bridge.address(), "/api/config"), nil, &config)
+		if err != nil {
+			return err
+		}
+		if config.BridgeId == "" {
+			return errors.New("Bridge reported no bridge ID")
+		}
+		bridgeID = config.BridgeId
+	}
+
+	bridge.lock.Lock()
+	defer bridge.lock.Unlock()
+
+	bridge.bridgeID = strings.ToUpper(bridgeID)
+	bridge.onAddressChange = onChange
+	return nil
+}
+
+// BridgeID returns the ID remembered by EnableRediscovery.
+func (bridge *Bridge) BridgeID() string {
+	bridge.lock.Lock()
+	defer bridge.lock.Unlock()
+
+	return bridge.bridgeID
+}
+
+// rediscoveryOutcome is the result of the last rediscovery of a bridge.
+type rediscoveryOutcome struct {
+	finished time.Time
+	err      error
+}
+
+// rediscover searches for the bridge after a request to failedAddr, which was
+// started at the given time, failed. Only one discovery runs at a time. Callers
+// waiting for it don't start another one: if the address changed, they use the
+// new address, otherwise they get the error of the discovery which finished
+// after their request was started.
+func (bridge *Bridge) rediscover(failedAddr string, started time.Time) error {
+	bridge.rediscoverLock.Lock()
+	defer bridge.rediscoverLock.Unlock()
+
+	bridge.lock.Lock()
+	bridgeID := bridge.bridgeID
+	onChange := bridge.onAddressChange
+	currentAddr := bridge.IpAddr
+	bridge.lock.Unlock()
+
+	if bridgeID == "" {
+		return errors.New("Rediscovery not enabled")
+	}
+	if currentAddr != failedAddr {
+		return nil // already rediscovered
+	}
+	if bridge.lastRediscovery.finished.After(started) {
+		return bridge.lastRediscovery.err
+	}
+
+	err := bridge.discoverAddress(bridgeID, currentAddr, onChange)
+	bridge.lastRediscovery = rediscoveryOutcome{finished: time.Now(), err: err}
+	return err
+}
+
+// discoverAddress searches the local network for the bridge with the given ID
+// and updates its address. The rediscoverLock must be held by the caller.
+func (bridge *Bridge) discoverAddress(bridgeID, currentAddr string, onChange func(AddressChange)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rediscoveryTimeout)
+	defer cancel()
+
+	for result := range NewDiscoverer().Stream(ctx) {
+		if result.BridgeID != bridgeID {
+			continue
+		}
+		newAddr := result.Bridge.IpAddr
+		if newAddr == currentAddr {
+			return errors.New("Bridge " + bridgeID + " found at unchanged address " + newAddr)
+		}
+
+		bridge.lock.Lock()
+		bridge.IpAddr = newAddr
+		bridge.negotiated = false
+		bridge.negotiationFailed = time.Time{}
+		bridge.apiVersion = nil // the bridge might have been updated in the meantime
+		bridge.lock.Unlock()
+
+		bridge.log(slog.LevelInfo, "Bridge address changed", "bridge_id", bridgeID, "old", currentAddr, "new", newAddr)
+		if onChange != nil {
+			onChange(AddressChange{BridgeID: bridgeID, OldAddr: currentAddr, NewAddr: newAddr})
+		}
+		return nil
+	}
+	return errors.New("Unable to find bridge " + bridgeID)
+}
+
+// isConnectionError reports whether err is caused by the network (e.g. the bridge
+// can't be reached) instead of an invalid response.
+func isConnectionError(err error) bool {
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// isDialError reports whether no connection to the bridge could be established
+// (e.g. connection refused or no route to host). Timeouts of established
+// connections don't indicate a changed address.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,276 @@
+package hue
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Error type reported by the bridge for resources which don't exist.
+const errorResourceNotAvailable = 3
+
+// ResourceLink represents a resourcelink saved on the bridge. Resourcelinks
+// group related resources (e.g. the rules, scenes and sensors configured for
+// a switch), which are referenced by their addresses like /scenes/<id>.
+type ResourceLink struct {
+	bridge      *Bridge
+	Id          string   `json:"-"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Type        string   `json:"type"`
+	ClassId     int      `json:"classid"`
+	Owner       string   `json:"owner"`
+	Recycle     bool     `json:"recycle"`
+	Links       []string `json:"links"`
+}
+
+// CreateResourceLink contains all necessary attributes to create a new resourcelink on the bridge.
+type CreateResourceLink struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	ClassId     int      `json:"classid"`
+	Recycle     bool     `json:"recycle,omitempty"`
+	Links       []string `json:"links"`
+}
+
+// ModifyResourceLink contains all attributes to be changed on a given resourcelink.
+type ModifyResourceLink struct {
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	ClassId     int      `json:"classid,omitempty"`
+	Links       []string `json:"links,omitempty"`
+}
+
+// CreateResourceLink stores a new resourcelink with the given attributes on the bridge.
+func (bridge *Bridge) CreateResourceLink(linkdata CreateResourceLink) ([]Result, error) {
+	err := bridge.checkCapacity(map[string]int{"resourcelinks": 1})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	err = bridge.post("/resourcelinks", &linkdata, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// AllResourceLinks returns all resourcelinks currently saved on the bridge.
+func (bridge *Bridge) AllResourceLinks() ([]*ResourceLink, error) {
+	var links []*ResourceLink
+	var results map[string]ResourceLink
+	err := bridge.get("/resourcelinks", &results)
+	if err != nil {
+		return links, err
+	}
+
+	// and convert them into resourcelinks
+	for id, link := range results {
+		link := link
+		link.Id = id
+		link.bridge = bridge
+		links = append(links, &link)
+	}
+
+	return links, nil
+}
+
+// ResourceLinkByID looks up the resourcelink with the given ID on the bridge.
+func (bridge *Bridge) ResourceLinkByID(id string) (*ResourceLink, error) {
+	var result ResourceLink
+	err := bridge.get("/resourcelinks/"+id, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Id = id
+	result.bridge = bridge
+
+	return &result, nil
+}
+
+// ResourceLinkByName looks up the resourcelink with the given name on the bridge.
+func (bridge *Bridge) ResourceLinkByName(name string) (*ResourceLink, error) {
+	links, err := bridge.AllResourceLinks()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, link := range links {
+		if link.Name == name {
+			return link, nil
+		}
+	}
+
+	return nil, errors.New("Unable to find resourcelink with name " + name)
+}
+
+// Modify adjusts a saved resourcelink according to the given attributes.
+func (link *ResourceLink) Modify(modifyLink ModifyResourceLink) ([]Result, error) {
+	var results []Result
+	err := link.bridge.put("/resourcelinks/"+link.Id, &modifyLink, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Delete will remove the given resourcelink from the bridge.
+// The linked resources are not changed.
+func (link *ResourceLink) Delete() ([]Result, error) {
+	var results []Result
+	err := link.bridge.delete("/resourcelinks/"+link.Id, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Resolve looks up all linked resources. The returned slice contains
+// values of type *Light, *Group, *Scene, *Sensor, *Rule, *Schedule or
+// *ResourceLink in the order of Links.
+func (link *ResourceLink) Resolve() ([]interface{}, error) {
+	var resources []interface{}
+	for _, address := range link.Links {
+		kind, id, err := splitResourceAddress(address)
+		if err != nil {
+			return resources, err
+		}
+
+		var resource interface{}
+		switch kind {
+		case "lights":
+			resource, err = link.bridge.FindLightById(id)
+		case "groups":
+			resource, err = link.bridge.GroupByID(id)
+		case "scenes":
+			resource, err = link.bridge.SceneByID(id)
+		case "sensors":
+			resource, err = link.bridge.SensorByID(id)
+		case "rules":
+			resource, err = link.bridge.RuleByID(id)
+		case "schedules":
+			resource, err = link.bridge.ScheduleByID(id)
+		case "resourcelinks":
+			resource, err = link.bridge.ResourceLinkByID(id)
+		}
+		if err != nil {
+			return resources, err
+		}
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+// DeleteCascading removes the resourcelink together with all resources it owns:
+// linked scenes, rules, schedules, CLIP sensors and resourcelinks (recursively).
+// Lights, groups and physical sensors are shared with other applications and
+// are never deleted. Already deleted resources are ignored. Rules and schedules
+// are deleted first, as the bridge refuses to delete scenes and sensors in use,
+// the resourcelinks are deleted last.
+func (link *ResourceLink) DeleteCascading() ([]Result, error) {
+	owned := &ownedResources{visited: map[string]bool{}}
+	err := owned.collect(link)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, paths := range [][]string{owned.users, owned.used} {
+		for _, path := range paths {
+			var deleted []Result
+			err = link.bridge.delete(path, &deleted)
+			results = append(results, deleted...)
+			if err == nil {
+				err = ignoreNotAvailable(resultsError(deleted))
+			}
+			if err != nil {
+				return results, err
+			}
+		}
+	}
+	for _, owner := range owned.links {
+		deleted, err := owner.Delete()
+		results = append(results, deleted...)
+		if err == nil {
+			err = ignoreNotAvailable(resultsError(deleted))
+		}
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// ownedResources contains the resources deleted by DeleteCascading.
+type ownedResources struct {
+	visited map[string]bool
+	users   []string        // rules and schedules
+	used    []string        // scenes and CLIP sensors
+	links   []*ResourceLink // nested resourcelinks before their parents
+}
+
+func (owned *ownedResources) collect(link *ResourceLink) error {
+	owned.visited["/resourcelinks/"+link.Id] = true
+
+	for _, address := range link.Links {
+		kind, id, err := splitResourceAddress(address)
+		if err != nil {
+			return err
+		}
+		path := fmt.Sprintf("/%s/%s", kind, id)
+		if owned.visited[path] {
+			continue
+		}
+		owned.visited[path] = true
+
+		switch kind {
+		case "rules", "schedules":
+			owned.users = append(owned.users, path)
+		case "scenes":
+			owned.used = append(owned.used, path)
+		case "sensors":
+			sensor, err := link.bridge.SensorByID(id)
+			if err != nil {
+				if ignoreNotAvailable(err) == nil {
+					continue // already deleted
+				}
+				return err
+			}
+			if strings.HasPrefix(sensor.Type, "CLIP") {
+				owned.used = append(owned.used, path)
+			}
+		case "resourcelinks":
+			nested, err := link.bridge.ResourceLinkByID(id)
+			if err != nil {
+				if ignoreNotAvailable(err) == nil {
+					continue // already deleted
+				}
+				return err
+			}
+			err = owned.collect(nested)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	owned.links = append(owned.links, link)
+	return nil
+}
+
+// splitResourceAddress returns the resource kind and ID of an address like /scenes/<id>.
+func splitResourceAddress(address string) (string, string, error) {
+	match := resourceAddress.FindStringSubmatch(address)
+	if match == nil {
+		return "", "", errors.New("Invalid resource address " + address)
+	}
+	return match[2], match[3], nil
+}
+
+func ignoreNotAvailable(err error) error {
+	if resultErr, ok := err.(*ResultError); ok && resultErr.Type == errorResourceNotAvailable {
+		return nil
+	}
+	return err
+}
@@ -1,7 +1,44 @@
 package hue
 
+import "fmt"
+
 // Result encapsulates the standard response message that the
 // bridge returns
 type Result struct {
 	Success map[string]interface{} `json:"success"`
+	Error   *ResultError           `json:"error"`
+}
+
+// ResultError describes a failed operation reported by the bridge.
+type ResultError struct {
+	Type        int    `json:"type"`
+	Address     string `json:"address"`
+	Description string `json:"description"`
+}
+
+func (err *ResultError) Error() string {
+	return fmt.Sprintf("%s (type %d, address %s)", err.Description, err.Type, err.Address)
+}
+
+// createdID extracts the ID of a newly created resource from the results of a create request.
+func createdID(results []Result) (string, error) {
+	for _, result := range results {
+		if id, ok := result.Success["id"]; ok {
+			return fmt.Sprint(id), nil
+		}
+		if result.Error != nil {
+			return "", result.Error
+		}
+	}
+	return "", fmt.Errorf("Bridge didn't return an id: %v", results)
+}
+
+// resultsError returns the first error reported in the given results.
+func resultsError(results []Result) error {
+	for _, result := range results {
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+	return nil
 }
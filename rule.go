@@ -0,0 +1,135 @@
+package hue
+
+import "errors"
+
+// Rule represents a rule saved on the bridge. A rule executes its actions
+// as soon as all of its conditions are met.
+type Rule struct {
+	bridge         *Bridge
+	Id             string          `json:"-"`
+	Name           string          `json:"name"`
+	Owner          string          `json:"owner"`
+	Created        string          `json:"created"`
+	LastTriggered  string          `json:"lasttriggered"`
+	TimesTriggered int             `json:"timestriggered"`
+	Status         string          `json:"status"`
+	Recycle        bool            `json:"recycle"`
+	Conditions     []RuleCondition `json:"conditions"`
+	Actions        []RuleAction    `json:"actions"`
+}
+
+// RuleCondition describes a single condition of a rule, e.g. a sensor state.
+type RuleCondition struct {
+	Address  string `json:"address"`
+	Operator string `json:"operator"`
+	Value    string `json:"value,omitempty"`
+}
+
+// RuleAction describes a request the bridge executes when a rule is triggered.
+type RuleAction struct {
+	Address string                 `json:"address"`
+	Method  string                 `json:"method"`
+	Body    map[string]interface{} `json:"body"`
+}
+
+// CreateRule contains all necessary attributes to create a new rule on the bridge.
+type CreateRule struct {
+	Name       string          `json:"name,omitempty"`
+	Status     string          `json:"status,omitempty"`
+	Recycle    bool            `json:"recycle,omitempty"`
+	Conditions []RuleCondition `json:"conditions"`
+	Actions    []RuleAction    `json:"actions"`
+}
+
+// ModifyRule contains all attributes to be changed on a given rule.
+type ModifyRule struct {
+	Name       string          `json:"name,omitempty"`
+	Status     string          `json:"status,omitempty"`
+	Conditions []RuleCondition `json:"conditions,omitempty"`
+	Actions    []RuleAction    `json:"actions,omitempty"`
+}
+
+// CreateRule stores a new rule with the given attributes on the bridge.
+func (bridge *Bridge) CreateRule(ruledata CreateRule) ([]Result, error) {
+	err := bridge.checkCapacity(map[string]int{"rules": 1, "rule conditions": len(ruledata.Conditions), "rule actions": len(ruledata.Actions)})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	err = bridge.post("/rules", &ruledata, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// AllRules returns all rules currently saved on the bridge.
+func (bridge *Bridge) AllRules() ([]*Rule, error) {
+	var rules []*Rule
+	var results map[string]Rule
+	err := bridge.get("/rules", &results)
+	if err != nil {
+		return rules, err
+	}
+
+	// and convert them into rules
+	for id, rule := range results {
+		rule := rule
+		rule.Id = id
+		rule.bridge = bridge
+		rules = append(rules, &rule)
+	}
+
+	return rules, nil
+}
+
+// RuleByID looks up the rule with the given ID on the bridge.
+func (bridge *Bridge) RuleByID(id string) (*Rule, error) {
+	var result Rule
+	err := bridge.get("/rules/"+id, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Id = id
+	result.bridge = bridge
+
+	return &result, nil
+}
+
+// RuleByName looks up the rule with the given name on the bridge.
+func (bridge *Bridge) RuleByName(name string) (*Rule, error) {
+	rules, err := bridge.AllRules()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		if rule.Name == name {
+			return rule, nil
+		}
+	}
+
+	return nil, errors.New("Unable to find rule with name " + name)
+}
+
+// Modify adjusts a saved rule according to the given attributes.
+func (rule *Rule) Modify(modifyRule ModifyRule) ([]Result, error) {
+	var results []Result
+	err := rule.bridge.put("/rules/"+rule.Id, &modifyRule, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Delete will remove the given rule from the bridge.
+func (rule *Rule) Delete() ([]Result, error) {
+	var results []Result
+	err := rule.bridge.delete("/rules/"+rule.Id, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -2,12 +2,24 @@ package hue
 
 import "fmt"
 import "errors"
+import "math"
+import "sort"
+import "strconv"
+
+// Scene types supported by the bridge. A LightScene stores the states of an
+// explicit list of lights while a GroupScene is bound to the lights of a group.
+const (
+	LightScene = "LightScene"
+	GroupScene = "GroupScene"
+)
 
 // Scene represents a Hue scene saved on the bridge.
 type Scene struct {
 	bridge      *Bridge
 	Id          string                 `json:"-"`
 	Name        string                 `json:"name"`
+	Type        string                 `json:"type"`
+	Group       string                 `json:"group"`
 	Lights      []string               `json:"lights"`
 	Owner       string                 `json:"owner"`
 	Recycle     bool                   `json:"recycle"`
@@ -20,40 +32,87 @@ type Scene struct {
 }
 
 // CreateScene contains all necessary attributes to create a new scene on the bridge.
+// Lights must be empty for scenes of type GroupScene, as they always contain the
+// lights of the given Group. If LightStates is empty, the current states of
+// all lights are captured by the bridge. TransitionTime is used for all light
+// states which don't specify their own transition.
 type CreateScene struct {
-	Name           string                 `json:"name,omitempty"`
-	Lights         []string               `json:"lights,omitempty"`
-	Recycle        bool                   `json:"recycle"`
-	TransitionTime int                    `json:"transistiontime,omitempty"`
-	Appdata        map[string]interface{} `json:"appdata,omitempty"`
-	Picture        string                 `json:"picture,omitempty"`
+	Name           string                      `json:"name,omitempty"`
+	Type           string                      `json:"type,omitempty"`
+	Group          string                      `json:"group,omitempty"`
+	Lights         []string                    `json:"lights,omitempty"`
+	Recycle        bool                        `json:"recycle"`
+	TransitionTime int                         `json:"transitiontime,omitempty"`
+	Appdata        map[string]interface{}      `json:"appdata,omitempty"`
+	Picture        string                      `json:"picture,omitempty"`
+	LightStates    map[string]ModifyLightState `json:"lightstates,omitempty"`
 }
 
 // ModifyScene contains all attributes to be changed on a given scene.
 type ModifyScene struct {
-	Name            string   `json:"name,omitempty"`
-	Lights          []string `json:"lights,omitempty"`
-	StoreLightState bool     `json:"storelightstate,omitempty"`
+	Name            string                      `json:"name,omitempty"`
+	Lights          []string                    `json:"lights,omitempty"`
+	StoreLightState bool                        `json:"storelightstate,omitempty"`
+	Appdata         map[string]interface{}      `json:"appdata,omitempty"`
+	Picture         string                      `json:"picture,omitempty"`
+	LightStates     map[string]ModifyLightState `json:"lightstates,omitempty"`
 }
 
 // ModifyLightState contains all light attributes to be changed on a given scene.
+// On, Hue, Saturation and TransitionTime are pointers, as their zero values
+// (off, red, white and an instant transition) are valid states.
 type ModifyLightState struct {
-	On               bool      `json:"on,omitempty"`
+	On               *bool     `json:"on,omitempty"`
 	Brightness       uint8     `json:"bri,omitempty"`
-	Hue              uint16    `json:"hue,omitempty"`
-	Saturation       uint8     `json:"sat,omitempty"`
+	Hue              *uint16   `json:"hue,omitempty"`
+	Saturation       *uint8    `json:"sat,omitempty"`
 	Xy               []float32 `json:"xy,omitempty"`
 	ColorTemperature uint16    `json:"ct,omitempty"`
 	Effect           string    `json:"effect,omitempty"`
-	TransitionTime   uint16    `json:"transistiontime,omitempty"`
+	TransitionTime   *uint16   `json:"transitiontime,omitempty"`
 }
 
 // CreateScene stores a new scene with the given attributes on the bridge.
-// In addition to the given information the current light states of all referenced
-// lights will be part of the scene.
+// Unless explicit light states are given, the current light states of all
+// referenced lights will be part of the scene.
 func (bridge *Bridge) CreateScene(scenedata CreateScene) ([]Result, error) {
+	if scenedata.Type == GroupScene {
+		if scenedata.Group == "" {
+			return nil, errors.New("GroupScene requires a group")
+		}
+		if len(scenedata.Lights) > 0 {
+			return nil, errors.New("GroupScene can't contain explicit lights")
+		}
+	}
+	if scenedata.Type != GroupScene && len(scenedata.Lights) == 0 {
+		for lightID := range scenedata.LightStates {
+			scenedata.Lights = append(scenedata.Lights, lightID)
+		}
+		sort.Strings(scenedata.Lights)
+	}
+	if scenedata.TransitionTime > 0 && len(scenedata.LightStates) > 0 {
+		lightstates := make(map[string]ModifyLightState)
+		for lightID, lightstate := range scenedata.LightStates {
+			if lightstate.TransitionTime == nil {
+				transitionTime := uint16(scenedata.TransitionTime)
+				lightstate.TransitionTime = &transitionTime
+			}
+			lightstates[lightID] = lightstate
+		}
+		scenedata.LightStates = lightstates
+	}
+
+	lightstates := len(scenedata.LightStates)
+	if lightstates == 0 {
+		lightstates = len(scenedata.Lights)
+	}
+	err := bridge.checkCapacity(map[string]int{"scenes": 1, "scene lightstates": lightstates})
+	if err != nil {
+		return nil, err
+	}
+
 	var results []Result
-	err := bridge.post("/scenes/", &scenedata, &results)
+	err = bridge.post("/scenes/", &scenedata, &results)
 	if err != nil {
 		return nil, err
 	}
@@ -98,6 +157,29 @@ func (bridge *Bridge) SceneByID(id string) (*Scene, error) {
 	return &result, nil
 }
 
+// StoredScene is a scene with its light states decoded as stored on the bridge,
+// as used by Backup. Unlike Scene.LightStates, attributes which aren't part of
+// the scene stay nil, so valid zero values (e.g. hue 0) can be told apart from
+// missing ones.
+type StoredScene struct {
+	Scene
+	LightStates map[string]ModifyLightState `json:"lightstates"`
+}
+
+// storedSceneByID looks up the scene with the given ID including its stored light states.
+func (bridge *Bridge) storedSceneByID(id string) (*StoredScene, error) {
+	var result StoredScene
+	err := bridge.get(fmt.Sprintf("/scenes/%s", id), &result)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Id = id
+	result.bridge = bridge
+
+	return &result, nil
+}
+
 // SceneByName looks up the scene with the given name on the bridge.
 func (bridge *Bridge) SceneByName(name string) (*Scene, error) {
 	scenes, err := bridge.AllScenes()
@@ -160,13 +242,111 @@ func (scene *Scene) Delete() ([]Result, error) {
 	return results, err
 }
 
+// ActivateOptions controls how a scene is recalled by ActivateInGroup.
+type ActivateOptions struct {
+	// TransitionTime overrides the transitions stored in the scene.
+	// This is given as a multiple of 100ms, nil keeps the stored transitions.
+	TransitionTime *uint16
+
+	// BrightnessScale scales the stored brightness of all lights,
+	// e.g. 0.3 recalls the scene at 30% of its brightness. Zero keeps the
+	// stored brightness.
+	BrightnessScale float64
+}
+
 // Activate will recall the given scene according to it's state on the bridge.
 func (scene *Scene) Activate() ([]Result, error) {
-	request := map[string]string{"scene": scene.Id}
+	return scene.ActivateInGroup("0", ActivateOptions{})
+}
+
+// ActivateInGroup recalls the given scene for all lights of the given group
+// which are part of the scene. Lights outside the group are not changed.
+func (scene *Scene) ActivateInGroup(groupID string, opts ActivateOptions) ([]Result, error) {
+	if opts.BrightnessScale > 0 && opts.BrightnessScale != 1 {
+		return scene.activateScaled(groupID, opts)
+	}
+
+	request := map[string]interface{}{"scene": scene.Id}
+	if opts.TransitionTime != nil {
+		request["transitiontime"] = *opts.TransitionTime
+	}
 	var results []Result
-	err := scene.bridge.put("/groups/0/action", &request, &results)
+	err := scene.bridge.put("/groups/"+groupID+"/action", &request, &results)
 	if err != nil {
 		return nil, err
 	}
 	return results, nil
 }
+
+// activateScaled applies the stored light states with scaled brightness.
+// The bridge can't scale a scene on recall, so the states are sent as a batch.
+func (scene *Scene) activateScaled(groupID string, opts ActivateOptions) ([]Result, error) {
+	stored, err := scene.bridge.storedSceneByID(scene.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	inGroup := func(string) bool { return true }
+	if groupID != "0" {
+		group, err := scene.bridge.GroupByID(groupID)
+		if err != nil {
+			return nil, err
+		}
+		members := make(map[string]bool)
+		for _, lightID := range group.Lights {
+			members[lightID] = true
+		}
+		inGroup = func(lightID string) bool { return members[lightID] }
+	}
+
+	batch := scene.bridge.NewStateBatch()
+	for lightID, lightstate := range stored.LightStates {
+		if !inGroup(lightID) {
+			continue
+		}
+		state := scaledLightState(lightstate, opts.BrightnessScale)
+		if opts.TransitionTime != nil {
+			state.TransitionTime = strconv.Itoa(int(*opts.TransitionTime))
+		}
+		batch.Set(lightID, state)
+	}
+	return batch.Apply()
+}
+
+// scaledLightState converts a stored scene light state into a state which can
+// be sent to a light, scaling its brightness by the given factor.
+func scaledLightState(lightstate ModifyLightState, scale float64) SetLightState {
+	var state SetLightState
+	if lightstate.TransitionTime != nil {
+		state.TransitionTime = strconv.Itoa(int(*lightstate.TransitionTime))
+	}
+	if lightstate.On != nil {
+		state.On = strconv.FormatBool(*lightstate.On)
+		if !*lightstate.On {
+			return state
+		}
+	}
+
+	if lightstate.Brightness > 0 {
+		bri := int(math.Round(float64(lightstate.Brightness) * scale))
+		if bri < 1 {
+			bri = 1
+		}
+		if bri > 254 {
+			bri = 254
+		}
+		state.Bri = strconv.Itoa(bri)
+	}
+	state.Xy = lightstate.Xy
+	if lightstate.ColorTemperature > 0 {
+		state.Ct = strconv.Itoa(int(lightstate.ColorTemperature))
+	}
+	if lightstate.Hue != nil {
+		state.Hue = strconv.Itoa(int(*lightstate.Hue))
+	}
+	if lightstate.Saturation != nil {
+		state.Sat = strconv.Itoa(int(*lightstate.Saturation))
+	}
+	state.Effect = lightstate.Effect
+	return state
+}
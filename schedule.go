@@ -0,0 +1,134 @@
+package hue
+
+import "errors"
+
+// Schedule represents a schedule saved on the bridge. A schedule executes
+// its command at the given (bridge local) time.
+type Schedule struct {
+	bridge      *Bridge
+	Id          string          `json:"-"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Command     ScheduleCommand `json:"command"`
+	LocalTime   string          `json:"localtime"`
+	Created     string          `json:"created"`
+	Status      string          `json:"status"`
+	AutoDelete  bool            `json:"autodelete"`
+	StartTime   string          `json:"starttime"`
+	Recycle     bool            `json:"recycle"`
+}
+
+// ScheduleCommand describes the request the bridge executes for a schedule.
+// Address contains the full path including the username, e.g.
+// /api/<username>/groups/0/action.
+type ScheduleCommand struct {
+	Address string                 `json:"address"`
+	Method  string                 `json:"method"`
+	Body    map[string]interface{} `json:"body"`
+}
+
+// CreateSchedule contains all necessary attributes to create a new schedule on the bridge.
+type CreateSchedule struct {
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Command     ScheduleCommand `json:"command"`
+	LocalTime   string          `json:"localtime"`
+	Status      string          `json:"status,omitempty"`
+	AutoDelete  *bool           `json:"autodelete,omitempty"`
+	Recycle     bool            `json:"recycle,omitempty"`
+}
+
+// ModifySchedule contains all attributes to be changed on a given schedule.
+type ModifySchedule struct {
+	Name        string           `json:"name,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Command     *ScheduleCommand `json:"command,omitempty"`
+	LocalTime   string           `json:"localtime,omitempty"`
+	Status      string           `json:"status,omitempty"`
+	AutoDelete  *bool            `json:"autodelete,omitempty"`
+}
+
+// CreateSchedule stores a new schedule with the given attributes on the bridge.
+func (bridge *Bridge) CreateSchedule(scheduledata CreateSchedule) ([]Result, error) {
+	err := bridge.checkCapacity(map[string]int{"schedules": 1})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	err = bridge.post("/schedules", &scheduledata, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// AllSchedules returns all schedules currently saved on the bridge.
+func (bridge *Bridge) AllSchedules() ([]*Schedule, error) {
+	var schedules []*Schedule
+	var results map[string]Schedule
+	err := bridge.get("/schedules", &results)
+	if err != nil {
+		return schedules, err
+	}
+
+	// and convert them into schedules
+	for id, schedule := range results {
+		schedule := schedule
+		schedule.Id = id
+		schedule.bridge = bridge
+		schedules = append(schedules, &schedule)
+	}
+
+	return schedules, nil
+}
+
+// ScheduleByID looks up the schedule with the given ID on the bridge.
+func (bridge *Bridge) ScheduleByID(id string) (*Schedule, error) {
+	var result Schedule
+	err := bridge.get("/schedules/"+id, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Id = id
+	result.bridge = bridge
+
+	return &result, nil
+}
+
+// ScheduleByName looks up the schedule with the given name on the bridge.
+func (bridge *Bridge) ScheduleByName(name string) (*Schedule, error) {
+	schedules, err := bridge.AllSchedules()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, schedule := range schedules {
+		if schedule.Name == name {
+			return schedule, nil
+		}
+	}
+
+	return nil, errors.New("Unable to find schedule with name " + name)
+}
+
+// Modify adjusts a saved schedule according to the given attributes.
+func (schedule *Schedule) Modify(modifySchedule ModifySchedule) ([]Result, error) {
+	var results []Result
+	err := schedule.bridge.put("/schedules/"+schedule.Id, &modifySchedule, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Delete will remove the given schedule from the bridge.
+func (schedule *Schedule) Delete() ([]Result, error) {
+	var results []Result
+	err := schedule.bridge.delete("/schedules/"+schedule.Id, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,139 @@
+package hue
+
+import "errors"
+
+// Sensor represents a physical or virtual (CLIP) sensor known to the bridge.
+// State and Config depend on the sensor type.
+type Sensor struct {
+	bridge           *Bridge
+	Id               string                 `json:"-"`
+	Name             string                 `json:"name"`
+	Type             string                 `json:"type"`
+	ModelId          string                 `json:"modelid"`
+	ManufacturerName string                 `json:"manufacturername"`
+	SoftwareVersion  string                 `json:"swversion"`
+	SoftwareUpdate   *SoftwareUpdateState   `json:"swupdate,omitempty"`
+	UniqueId         string                 `json:"uniqueid,omitempty"`
+	Recycle          bool                   `json:"recycle,omitempty"`
+	State            map[string]interface{} `json:"state"`
+	Config           map[string]interface{} `json:"config"`
+}
+
+// CreateSensor contains all necessary attributes to create a new CLIP sensor on the bridge.
+type CreateSensor struct {
+	Name             string                 `json:"name"`
+	Type             string                 `json:"type"`
+	ModelId          string                 `json:"modelid"`
+	ManufacturerName string                 `json:"manufacturername"`
+	SoftwareVersion  string                 `json:"swversion"`
+	UniqueId         string                 `json:"uniqueid"`
+	Recycle          bool                   `json:"recycle,omitempty"`
+	State            map[string]interface{} `json:"state,omitempty"`
+	Config           map[string]interface{} `json:"config,omitempty"`
+}
+
+// CreateSensor stores a new CLIP sensor with the given attributes on the bridge.
+func (bridge *Bridge) CreateSensor(sensordata CreateSensor) ([]Result, error) {
+	err := bridge.checkCapacity(map[string]int{"sensors": 1})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	err = bridge.post("/sensors", &sensordata, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// AllSensors returns all sensors known to the bridge.
+func (bridge *Bridge) AllSensors() ([]*Sensor, error) {
+	var sensors []*Sensor
+	var results map[string]Sensor
+	err := bridge.get("/sensors", &results)
+	if err != nil {
+		return sensors, err
+	}
+
+	// and convert them into sensors
+	for id, sensor := range results {
+		sensor := sensor
+		sensor.Id = id
+		sensor.bridge = bridge
+		sensors = append(sensors, &sensor)
+	}
+
+	return sensors, nil
+}
+
+// SensorByID looks up the sensor with the given ID on the bridge.
+func (bridge *Bridge) SensorByID(id string) (*Sensor, error) {
+	var result Sensor
+	err := bridge.get("/sensors/"+id, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Id = id
+	result.bridge = bridge
+
+	return &result, nil
+}
+
+// SensorByName looks up the sensor with the given name on the bridge.
+func (bridge *Bridge) SensorByName(name string) (*Sensor, error) {
+	sensors, err := bridge.AllSensors()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sensor := range sensors {
+		if sensor.Name == name {
+			return sensor, nil
+		}
+	}
+
+	return nil, errors.New("Unable to find sensor with name " + name)
+}
+
+// SetName renames the given sensor.
+func (sensor *Sensor) SetName(newName string) ([]Result, error) {
+	params := map[string]string{"name": newName}
+	var results []Result
+	err := sensor.bridge.put("/sensors/"+sensor.Id, &params, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ModifyConfig changes the given configuration attributes of the sensor.
+func (sensor *Sensor) ModifyConfig(config map[string]interface{}) ([]Result, error) {
+	var results []Result
+	err := sensor.bridge.put("/sensors/"+sensor.Id+"/config", &config, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ModifyState changes the given state attributes of a CLIP sensor.
+func (sensor *Sensor) ModifyState(state map[string]interface{}) ([]Result, error) {
+	var results []Result
+	err := sensor.bridge.put("/sensors/"+sensor.Id+"/state", &state, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Delete will remove the given sensor from the bridge.
+func (sensor *Sensor) Delete() ([]Result, error) {
+	var results []Result
+	err := sensor.bridge.delete("/sensors/"+sensor.Id, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
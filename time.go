@@ -0,0 +1,100 @@
+package hue
+
+import (
+	"errors"
+	"time"
+)
+
+// Layout of all timestamps reported by the bridge.
+const bridgeTimeLayout = "2006-01-02T15:04:05"
+
+// ErrScanActive is returned by ParseLastScan while the bridge searches for new lights.
+var ErrScanActive = errors.New("Search for new lights is still active")
+
+// Location returns the time zone the bridge is configured for.
+func (config *Configuration) Location() (*time.Location, error) {
+	if config.Timezone == "" || config.Timezone == "none" {
+		return nil, errors.New("Bridge has no time zone configured")
+	}
+	return time.LoadLocation(config.Timezone)
+}
+
+// UTCTime returns the current time of the bridge clock as reported in the configuration.
+func (config *Configuration) UTCTime() (time.Time, error) {
+	return ParseBridgeTime(config.UTC, time.UTC)
+}
+
+// LocalTime returns the current local time of the bridge as reported in the configuration.
+func (config *Configuration) LocalTime() (time.Time, error) {
+	loc, err := config.Location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ParseBridgeTime(config.Localtime, loc)
+}
+
+// Location returns the time zone the bridge is configured for.
+func (bridge *Bridge) Location() (*time.Location, error) {
+	config, err := bridge.Configuration()
+	if err != nil {
+		return nil, err
+	}
+	return config.Location()
+}
+
+// Timezones returns the names of all time zones supported by the bridge.
+func (bridge *Bridge) Timezones() ([]string, error) {
+	var timezones []string
+	err := bridge.get("/info/timezones", &timezones)
+	if err == nil && len(timezones) > 0 {
+		return timezones, nil
+	}
+
+	// Moved to the capabilities with bridge API version 1.15
+	capabilities, err := bridge.Capabilities()
+	if err != nil {
+		return nil, err
+	}
+	return capabilities.Timezones.Values, nil
+}
+
+// ParseBridgeTime parses a timestamp as reported by the bridge, e.g.
+// 2017-05-31T12:00:00. Timestamps like lastupdated are given in UTC while
+// local times (e.g. schedules) are given in the time zone of the bridge.
+func ParseBridgeTime(value string, loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation(bridgeTimeLayout, value, loc)
+}
+
+// FormatBridgeTime formats the given time in the given location as expected
+// by the bridge, e.g. for the local time of a schedule.
+func FormatBridgeTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(bridgeTimeLayout)
+}
+
+// ParseLastScan parses the time of the last search for new lights as returned
+// by GetNewLights. It returns the zero time if the bridge never searched for
+// lights and ErrScanActive while a search is running.
+func ParseLastScan(lastScan string, loc *time.Location) (time.Time, error) {
+	switch lastScan {
+	case "none":
+		return time.Time{}, nil
+	case "active":
+		return time.Time{}, ErrScanActive
+	}
+	return ParseBridgeTime(lastScan, loc)
+}
+
+// LastUpdatedTime returns the time the scene was last changed.
+func (scene *Scene) LastUpdatedTime() (time.Time, error) {
+	return ParseBridgeTime(scene.LastUpdated, time.UTC)
+}
+
+// LastUpdated returns the time the sensor state was last changed.
+// It returns the zero time if the sensor was never updated.
+func (sensor *Sensor) LastUpdated() (time.Time, error) {
+	lastUpdated, _ := sensor.State["lastupdated"].(string)
+	if lastUpdated == "" || lastUpdated == "none" {
+		return time.Time{}, nil
+	}
+	return ParseBridgeTime(lastUpdated, time.UTC)
+}
@@ -0,0 +1,145 @@
+package hue
+
+import (
+	"context"
+	"time"
+)
+
+// Software update states reported by the bridge and its devices.
+const (
+	UpdateNone              = "noupdates"
+	UpdateTransferring      = "transferring"
+	UpdateReadyToInstall    = "readytoinstall"
+	UpdateAnyReadyToInstall = "anyreadytoinstall"
+	UpdateAllReadyToInstall = "allreadytoinstall"
+	UpdateInstalling        = "installing"
+	UpdateNotUpdatable      = "notupdatable"
+	UpdateUnknown           = "unknown"
+)
+
+// UpdateStatus contains the software update state of the bridge and all
+// connected devices. Lights and Sensors are keyed by their IDs.
+type UpdateStatus struct {
+	SoftwareUpdate2
+	Lights  map[string]SoftwareUpdateState
+	Sensors map[string]SoftwareUpdateState
+}
+
+// Done reports whether the bridge and all devices are up to date.
+func (status *UpdateStatus) Done() bool {
+	if status.CheckForUpdate || status.State != UpdateNone {
+		return false
+	}
+	for _, devices := range []map[string]SoftwareUpdateState{status.Lights, status.Sensors} {
+		for _, device := range devices {
+			if !updateFinished(device.State) {
+				return false
+			}
+		}
+	}
+	return updateFinished(status.Bridge.State)
+}
+
+// CheckForUpdates tells the bridge to look for new software for itself and
+// all connected devices. The result is reported by UpdateStatus once
+// CheckForUpdate is reset by the bridge.
+func (bridge *Bridge) CheckForUpdates() ([]Result, error) {
+	return bridge.putSoftwareUpdate(map[string]interface{}{"checkforupdate": true})
+}
+
+// InstallUpdates starts the installation of all updates ready to install.
+// The bridge and the updated lights will be unavailable for a few minutes.
+func (bridge *Bridge) InstallUpdates() ([]Result, error) {
+	defer bridge.forgetAPIVersion()
+	return bridge.putSoftwareUpdate(map[string]interface{}{"install": true})
+}
+
+// ConfigureAutoInstall enables or disables the automatic installation of
+// updates. The installation starts at the given local time, e.g. T14:00:00.
+func (bridge *Bridge) ConfigureAutoInstall(on bool, updateTime string) ([]Result, error) {
+	autoinstall := map[string]interface{}{"on": on}
+	if updateTime != "" {
+		autoinstall["updatetime"] = updateTime
+	}
+	return bridge.putSoftwareUpdate(map[string]interface{}{"autoinstall": autoinstall})
+}
+
+// UpdateStatus returns the software update state of the bridge and all devices.
+func (bridge *Bridge) UpdateStatus() (*UpdateStatus, error) {
+	config, err := bridge.Configuration()
+	if err != nil {
+		return nil, err
+	}
+	status := UpdateStatus{
+		SoftwareUpdate2: config.SoftwareUpdate2,
+		Lights:          make(map[string]SoftwareUpdateState),
+		Sensors:         make(map[string]SoftwareUpdateState),
+	}
+
+	lights, err := bridge.GetAllLights()
+	if err != nil {
+		return nil, err
+	}
+	for _, light := range lights {
+		status.Lights[light.Id] = light.Attributes.SoftwareUpdate
+	}
+
+	sensors, err := bridge.AllSensors()
+	if err != nil {
+		return nil, err
+	}
+	for _, sensor := range sensors {
+		if sensor.SoftwareUpdate != nil {
+			status.Sensors[sensor.Id] = *sensor.SoftwareUpdate
+		}
+	}
+
+	return &status, nil
+}
+
+// WaitForUpdates polls the update state in the given interval until the bridge
+// and all devices report that no updates are pending or the context is done.
+// The progress function (if given) is called whenever the state changes.
+// Errors while polling are ignored, as the bridge is unreachable while it
+// installs an update.
+func (bridge *Bridge) WaitForUpdates(ctx context.Context, interval time.Duration, progress func(*UpdateStatus)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last string
+	for {
+		status, err := bridge.UpdateStatus()
+		if err == nil {
+			if current := jsonString(status); current != last {
+				last = current
+				if progress != nil {
+					progress(status)
+				}
+			}
+			if status.Done() {
+				bridge.forgetAPIVersion() // the bridge might run a new version
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (bridge *Bridge) putSoftwareUpdate(swupdate map[string]interface{}) ([]Result, error) {
+	request := map[string]interface{}{"swupdate2": swupdate}
+	var results []Result
+	err := bridge.put("/config", &request, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func updateFinished(state string) bool {
+	return state == "" || state == UpdateNone || state == UpdateNotUpdatable
+}
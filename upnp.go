@@ -1,45 +1,157 @@
 package hue
 
+import "bufio"
+import "bytes"
+import "context"
 import "time"
 import "net"
+import "net/http"
+import "net/url"
+import "strconv"
 import "strings"
 import "errors"
+import "fmt"
 
 const upnpTimeout = 3 * time.Second
 
+// Search target answered by hue bridges
+// (see https://developers.meethue.com/documentation/hue-bridge-discovery)
+const ssdpSearchTarget = "urn:schemas-upnp-org:device:basic:1"
+
 // SSDP Payload - Make sure to keep linebreaks and indention untouched.
 const ssdpPayload = `M-SEARCH * HTTP/1.1
-HOST: 239.255.255.250:1900
-ST: ssdp:all
-MAN: ssdp:discover
+HOST: %s
+ST: %s
+MAN: "ssdp:discover"
 MX: 2
 
 `
 
-func upnpDiscover(respondingHosts chan<- string) error {
-	// Open listening port for incoming responses
-	socket, err := net.ListenUDP("udp4", &net.UDPAddr{Port: 1900})
+// SSDP multicast groups for IPv4 and IPv6 (link-local scope).
+var (
+	ssdpGroupIPv4 = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+	ssdpGroupIPv6 = &net.UDPAddr{IP: net.ParseIP("ff02::c"), Port: 1900}
+)
+
+// ssdpSocket describes where a search request is sent from and to.
+type ssdpSocket struct {
+	local *net.UDPAddr
+	group *net.UDPAddr
+}
+
+// upnpDiscover searches for bridges on the given network interfaces (all if
+// none are given) via IPv4 and IPv6 multicast. Requests are sent from an
+// ephemeral port, so port 1900 can stay in use by other UPnP services.
+// It only fails if none of the interfaces can be used.
+func upnpDiscover(ctx context.Context, ifaces []net.Interface, respondingHosts chan<- DiscoveredHost) error {
+	sockets, err := ssdpSockets(ifaces)
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, len(sockets))
+	for _, socket := range sockets {
+		go func(socket ssdpSocket) {
+			errs <- ssdpSearch(ctx, socket, respondingHosts)
+		}(socket)
+	}
+
+	failed := 0
+	for range sockets {
+		if e := <-errs; e != nil {
+			err = e
+			failed++
+		}
+	}
+	if failed < len(sockets) {
+		return nil
+	}
+	return err
+}
+
+// ssdpSockets returns a socket for every IP version available on the given
+// interfaces. Binding the source address of a socket selects the interface
+// IPv4 multicast is sent on, IPv6 uses the zone of the group instead.
+func ssdpSockets(ifaces []net.Interface) ([]ssdpSocket, error) {
+	if len(ifaces) == 0 {
+		var err error
+		ifaces, err = net.Interfaces()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var sockets []ssdpSocket
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		var ipv4, ipv6 bool
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ip := ipnet.IP.To4(); ip != nil && !ipv4 {
+				ipv4 = true
+				sockets = append(sockets, ssdpSocket{
+					local: &net.UDPAddr{IP: ip},
+					group: ssdpGroupIPv4,
+				})
+			} else if ipnet.IP.To4() == nil && ipnet.IP.IsLinkLocalUnicast() && !ipv6 {
+				ipv6 = true
+				sockets = append(sockets, ssdpSocket{
+					local: &net.UDPAddr{IP: ipnet.IP, Zone: iface.Name},
+					group: &net.UDPAddr{IP: ssdpGroupIPv6.IP, Port: ssdpGroupIPv6.Port, Zone: iface.Name},
+				})
+			}
+		}
+	}
+
+	if len(sockets) == 0 {
+		return nil, errors.New("No network interface available for SSDP discovery")
+	}
+	return sockets, nil
+}
+
+// ssdpSearch sends a search request and reports all bridges responding on the socket.
+func ssdpSearch(ctx context.Context, ssdp ssdpSocket, respondingHosts chan<- DiscoveredHost) error {
+	network := "udp6"
+	if ssdp.local.IP.To4() != nil {
+		network = "udp4"
+	}
+
+	// Open ephemeral port for incoming responses
+	socket, err := net.ListenUDP(network, ssdp.local)
 	if err != nil {
 		return err
 	}
-	socket.SetDeadline(time.Now().Add(upnpTimeout))
 	defer socket.Close()
+	closeOnDone(ctx, socket)
 
-	// Send out discovery request as broadcast
-	rawBody := []byte(strings.Replace(ssdpPayload, "\n", "\r\n", -1))
-	_, err = socket.WriteToUDP(rawBody, &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900})
+	// Send out discovery request as multicast
+	payload := fmt.Sprintf(ssdpPayload, net.JoinHostPort(ssdp.group.IP.String(), strconv.Itoa(ssdp.group.Port)), ssdpSearchTarget)
+	rawBody := []byte(strings.Replace(payload, "\n", "\r\n", -1))
+	_, err = socket.WriteToUDP(rawBody, ssdp.group)
 	if err != nil {
 		return err
 	}
 
 	// Loop over responses until timeout hits
-	var origins []string // keep track of response origins (return each origin only once)
-loop:
+	origins := make(map[string]bool) // keep track of response origins (return each origin only once)
 	for {
 		// Read response
 		buf := make([]byte, 8192)
-		_, addr, err := socket.ReadFromUDP(buf)
+		n, addr, err := socket.ReadFromUDP(buf)
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil // discovery done
+			}
 			if e, ok := err.(net.Error); !ok || !e.Timeout() {
 				return err //legitimate error, not a timeout.
 			}
@@ -47,26 +159,29 @@ loop:
 		}
 
 		// Parse and validate response
-		body := string(buf)
-		valid, err := ssdpResponseValid(body, addr.IP)
-		if err != nil || !valid {
+		host, err := parseSSDPResponse(buf[:n], addr)
+		if err != nil {
 			continue // Ignore response
 		}
 
 		// Filter responses from duplicate origins
-		for _, origin := range origins {
-			if origin == addr.IP.String() {
-				continue loop // duplicate
-			}
+		if origins[host.Host] {
+			continue // duplicate
 		}
 
 		// Response seems valid and unique -> send to channel
-		origins = append(origins, addr.IP.String())
-		respondingHosts <- addr.IP.String()
+		origins[host.Host] = true
+		select {
+		case respondingHosts <- host:
+		case <-ctx.Done():
+			return nil
+		}
 	}
 }
 
-func ssdpResponseValid(body string, origin net.IP) (valid bool, err error) {
+// parseSSDPResponse validates the response and returns the bridge host
+// (including its port if it doesn't use port 80) and ID.
+func parseSSDPResponse(data []byte, origin *net.UDPAddr) (DiscoveredHost, error) {
 	/*
 		Response example:
 
@@ -77,41 +192,41 @@ func ssdpResponseValid(body string, origin net.IP) (valid bool, err error) {
 		LOCATION: http://192.168.178.241:80/description.xml
 		SERVER: FreeRTOS/7.4.2 UPnP/1.0 IpBridge/1.10.0
 		hue-bridgeid: 001788FFFE09A206
-		ST: upnp:rootdevice
-		USN: uuid:2f402f80-da50-11e1-9b23-00178809a206::upnp:rootdevice
+		ST: urn:schemas-upnp-org:device:basic:1
+		USN: uuid:2f402f80-da50-11e1-9b23-00178809a206
 
 		FROM: https://developers.meethue.com/documentation/changes-bridge-discovery
 	*/
 
-	// Validate header
-	if !strings.Contains(body, "HTTP/1.1 200 OK") {
-		return false, errors.New("Invalid SSDP response header")
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+	if err != nil {
+		return DiscoveredHost{}, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return DiscoveredHost{}, errors.New("Invalid SSDP response status " + resp.Status)
 	}
 
-	lower := strings.ToLower(body)
 	// Validate MUST fields (from UPnP Device Architecture 1.1)
-	if !strings.Contains(lower, "usn") || !strings.Contains(lower, "st") {
-		return false, errors.New("Invalid SSDP response")
+	if !strings.EqualFold(resp.Header.Get("ST"), ssdpSearchTarget) || resp.Header.Get("USN") == "" {
+		return DiscoveredHost{}, errors.New("Invalid SSDP response")
 	}
 
-	// Hue bridges send string "IpBridge" in SERVER field
-	// (see https://developers.meethue.com/documentation/hue-bridge-discovery)
-	if !strings.Contains(lower, "ipbridge") {
-		return false, errors.New("Origin is no hue bridge")
+	// Hue bridges send their ID and the string "IpBridge" in SERVER field
+	bridgeID := strings.ToUpper(resp.Header.Get("hue-bridgeid"))
+	if bridgeID == "" && !strings.Contains(strings.ToLower(resp.Header.Get("SERVER")), "ipbridge") {
+		return DiscoveredHost{}, errors.New("Origin is no hue bridge")
 	}
 
 	// Validate IP in LOCATION field
-	if !strings.Contains(lower, "location") {
-		return false, errors.New("Invalid hue bridge response")
+	location, err := url.Parse(resp.Header.Get("LOCATION"))
+	if err != nil {
+		return DiscoveredHost{}, err
 	}
-	s := strings.SplitAfter(lower, "location: ")
-	location := strings.Split(s[1], "\n")[0]
-	s = strings.SplitAfter(location, "http://")
-	ip := strings.Split(s[1], ":")[0]
-
-	if ip != origin.String() {
-		return false, errors.New("Response and sender mismatch")
+	ip := net.ParseIP(location.Hostname())
+	if ip == nil || !ip.Equal(origin.IP) {
+		return DiscoveredHost{}, errors.New("Response and sender mismatch")
 	}
 
-	return true, nil
+	return DiscoveredHost{Host: joinHost(origin.IP, origin.Zone, location.Port()), BridgeID: bridgeID}, nil
 }
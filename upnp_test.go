@@ -0,0 +1,130 @@
+package hue
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+// ssdpResponse builds an SSDP response from the given header lines.
+func ssdpResponse(lines ...string) []byte {
+	return []byte(strings.Join(append(lines, "", ""), "\r\n"))
+}
+
+// Response of a hue bridge (API version 1.10) to an M-SEARCH request.
+var ssdpBridgeResponse = ssdpResponse(
+	"HTTP/1.1 200 OK",
+	"HOST: 239.255.255.250:1900",
+	"EXT:",
+	"CACHE-CONTROL: max-age=100",
+	"LOCATION: http://192.168.178.241:80/description.xml",
+	"SERVER: FreeRTOS/7.4.2 UPnP/1.0 IpBridge/1.10.0",
+	"hue-bridgeid: 001788FFFE09A206",
+	"ST: urn:schemas-upnp-org:device:basic:1",
+	"USN: uuid:2f402f80-da50-11e1-9b23-00178809a206",
+)
+
+func TestParseSSDPResponse(t *testing.T) {
+	origin := &net.UDPAddr{IP: net.ParseIP("192.168.178.241"), Port: 1900}
+	tests := []struct {
+		name    string
+		data    []byte
+		origin  *net.UDPAddr
+		host    DiscoveredHost
+		wantErr bool
+	}{
+		{"bridge", ssdpBridgeResponse, origin, DiscoveredHost{Host: "192.168.178.241", BridgeID: "001788FFFE09A206"}, false},
+		{"bridge without ID", ssdpResponse(
+			"HTTP/1.1 200 OK",
+			"LOCATION: http://192.168.178.241:80/description.xml",
+			"SERVER: Linux/3.14.0 UPnP/1.0 IpBridge/1.16.0",
+			"ST: urn:schemas-upnp-org:device:basic:1",
+			"USN: uuid:2f402f80-da50-11e1-9b23-00178809a206",
+		), origin, DiscoveredHost{Host: "192.168.178.241"}, false},
+		{"custom port", ssdpResponse(
+			"HTTP/1.1 200 OK",
+			"LOCATION: http://192.168.178.241:8080/description.xml",
+			"SERVER: Linux/3.14.0 UPnP/1.0 IpBridge/1.16.0",
+			"hue-bridgeid: 001788fffe09a206",
+			"st: urn:schemas-upnp-org:device:basic:1",
+			"usn: uuid:2f402f80-da50-11e1-9b23-00178809a206",
+		), origin, DiscoveredHost{Host: "192.168.178.241:8080", BridgeID: "001788FFFE09A206"}, false},
+		{"IPv6", ssdpResponse(
+			"HTTP/1.1 200 OK",
+			"LOCATION: http://[fe80::217:88ff:fe09:a206]:80/description.xml",
+			"SERVER: Linux/3.14.0 UPnP/1.0 IpBridge/1.16.0",
+			"hue-bridgeid: 001788FFFE09A206",
+			"ST: urn:schemas-upnp-org:device:basic:1",
+			"USN: uuid:2f402f80-da50-11e1-9b23-00178809a206",
+		), &net.UDPAddr{IP: net.ParseIP("fe80::217:88ff:fe09:a206"), Port: 1900, Zone: "eth0"}, DiscoveredHost{Host: "fe80::217:88ff:fe09:a206%eth0", BridgeID: "001788FFFE09A206"}, false},
+		{"malformed location", ssdpResponse(
+			"HTTP/1.1 200 OK",
+			"LOCATION: http://192.168.178.241:80%zz/description.xml",
+			"SERVER: FreeRTOS/7.4.2 UPnP/1.0 IpBridge/1.10.0",
+			"ST: urn:schemas-upnp-org:device:basic:1",
+			"USN: uuid:2f402f80-da50-11e1-9b23-00178809a206",
+		), origin, DiscoveredHost{}, true},
+		{"location without IP", ssdpResponse(
+			"HTTP/1.1 200 OK",
+			"LOCATION: http://philips-hue/description.xml",
+			"SERVER: FreeRTOS/7.4.2 UPnP/1.0 IpBridge/1.10.0",
+			"ST: urn:schemas-upnp-org:device:basic:1",
+			"USN: uuid:2f402f80-da50-11e1-9b23-00178809a206",
+		), origin, DiscoveredHost{}, true},
+		{"missing location", ssdpResponse(
+			"HTTP/1.1 200 OK",
+			"SERVER: FreeRTOS/7.4.2 UPnP/1.0 IpBridge/1.10.0",
+			"ST: urn:schemas-upnp-org:device:basic:1",
+			"USN: uuid:2f402f80-da50-11e1-9b23-00178809a206",
+		), origin, DiscoveredHost{}, true},
+		{"sender mismatch", ssdpBridgeResponse, &net.UDPAddr{IP: net.ParseIP("192.168.178.66"), Port: 1900}, DiscoveredHost{}, true},
+		{"wrong search target", ssdpResponse(
+			"HTTP/1.1 200 OK",
+			"LOCATION: http://192.168.178.241:80/description.xml",
+			"SERVER: FreeRTOS/7.4.2 UPnP/1.0 IpBridge/1.10.0",
+			"ST: urn:dial-multiscreen-org:service:dial:1",
+			"USN: uuid:2f402f80-da50-11e1-9b23-00178809a206",
+		), origin, DiscoveredHost{}, true},
+		{"missing USN", ssdpResponse(
+			"HTTP/1.1 200 OK",
+			"LOCATION: http://192.168.178.241:80/description.xml",
+			"SERVER: FreeRTOS/7.4.2 UPnP/1.0 IpBridge/1.10.0",
+			"ST: urn:schemas-upnp-org:device:basic:1",
+		), origin, DiscoveredHost{}, true},
+		{"other device", ssdpResponse(
+			"HTTP/1.1 200 OK",
+			"LOCATION: http://192.168.178.241:49000/description.xml",
+			"SERVER: Linux UPnP/1.0 AVM FRITZ!Box 7590",
+			"ST: urn:schemas-upnp-org:device:basic:1",
+			"USN: uuid:75802409-bccb-40e7-8e6c-3431c4e76d1e",
+		), origin, DiscoveredHost{}, true},
+		{"error status", ssdpResponse(
+			"HTTP/1.1 500 Internal Server Error",
+			"LOCATION: http://192.168.178.241:80/description.xml",
+			"SERVER: FreeRTOS/7.4.2 UPnP/1.0 IpBridge/1.10.0",
+			"ST: urn:schemas-upnp-org:device:basic:1",
+			"USN: uuid:2f402f80-da50-11e1-9b23-00178809a206",
+		), origin, DiscoveredHost{}, true},
+		{"search request", ssdpResponse(
+			"M-SEARCH * HTTP/1.1",
+			"HOST: 239.255.255.250:1900",
+			"MAN: \"ssdp:discover\"",
+			"MX: 10",
+			"ST: urn:schemas-upnp-org:device:basic:1",
+		), origin, DiscoveredHost{}, true},
+		{"truncated", ssdpBridgeResponse[:40], origin, DiscoveredHost{}, true},
+		{"garbage", []byte{0x00, 0xff, 0x13, 0x37}, origin, DiscoveredHost{}, true},
+		{"empty", []byte{}, origin, DiscoveredHost{}, true},
+	}
+
+	for _, test := range tests {
+		host, err := parseSSDPResponse(test.data, test.origin)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if host != test.host {
+			t.Errorf("%s: got %+v, want %+v", test.name, host, test.host)
+		}
+	}
+}
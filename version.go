@@ -0,0 +1,104 @@
+package hue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a comparable version number like the API version 1.24.0.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// ParseVersion parses a version number like 1.24.0. Missing minor or patch
+// numbers are treated as zero.
+func ParseVersion(value string) (Version, error) {
+	var version Version
+	parts := strings.SplitN(strings.TrimSpace(value), ".", 3)
+	numbers := []*int{&version.Major, &version.Minor, &version.Patch}
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return Version{}, fmt.Errorf("Invalid version %q", value)
+		}
+		*numbers[i] = number
+	}
+	return version, nil
+}
+
+// Compare returns -1, 0 or 1 if the version is lower, equal or higher than other.
+func (version Version) Compare(other Version) int {
+	for _, diff := range []int{version.Major - other.Major, version.Minor - other.Minor, version.Patch - other.Patch} {
+		if diff < 0 {
+			return -1
+		}
+		if diff > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// AtLeast reports whether the version is equal to or higher than other.
+func (version Version) AtLeast(other Version) bool {
+	return version.Compare(other) >= 0
+}
+
+func (version Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", version.Major, version.Minor, version.Patch)
+}
+
+// ParsedAPIVersion returns the API version of the bridge.
+func (config *Configuration) ParsedAPIVersion() (Version, error) {
+	return ParseVersion(config.APIVersion)
+}
+
+// ParsedSoftwareVersion returns the software version of the bridge. Newer
+// bridges report a build number, which is returned as major version.
+func (config *Configuration) ParsedSoftwareVersion() (Version, error) {
+	return ParseVersion(config.SoftwareVersion)
+}
+
+// SupportsAPI reports whether the bridge implements at least the given API
+// version, e.g. SupportsAPI("1.24.0") before calling EnableHTTPS.
+// The API version is requested once and again after a software update was
+// installed or the bridge was found at a new address.
+func (bridge *Bridge) SupportsAPI(minVersion string) (bool, error) {
+	required, err := ParseVersion(minVersion)
+	if err != nil {
+		return false, err
+	}
+
+	bridge.lock.Lock()
+	apiVersion := bridge.apiVersion
+	bridge.lock.Unlock()
+
+	if apiVersion == nil {
+		config, err := bridge.Configuration()
+		if err != nil {
+			return false, err
+		}
+		version, err := config.ParsedAPIVersion()
+		if err != nil {
+			return false, err
+		}
+		apiVersion = &version
+
+		bridge.lock.Lock()
+		bridge.apiVersion = apiVersion
+		bridge.lock.Unlock()
+	}
+
+	return apiVersion.AtLeast(required), nil
+}
+
+// forgetAPIVersion clears the API version cached by SupportsAPI.
+func (bridge *Bridge) forgetAPIVersion() {
+	bridge.lock.Lock()
+	defer bridge.lock.Unlock()
+
+	bridge.apiVersion = nil
+}
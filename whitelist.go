@@ -0,0 +1,72 @@
+package hue
+
+import (
+	"sort"
+	"time"
+)
+
+// LastUsed returns the time the application last accessed the bridge.
+// It returns the zero time if the bridge didn't report a valid date.
+func (entry WhitelistEntry) LastUsed() time.Time {
+	lastUse, _ := ParseBridgeTime(entry.LastUseDate, time.UTC)
+	return lastUse
+}
+
+// Created returns the time the application was registered on the bridge.
+// It returns the zero time if the bridge didn't report a valid date.
+func (entry WhitelistEntry) Created() time.Time {
+	created, _ := ParseBridgeTime(entry.CreateDate, time.UTC)
+	return created
+}
+
+// Whitelist returns all applications registered on the bridge,
+// most recently used first.
+func (bridge *Bridge) Whitelist() ([]WhitelistEntry, error) {
+	config, err := bridge.Configuration()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []WhitelistEntry
+	for _, entry := range config.Whitelist {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed().After(entries[j].LastUsed())
+	})
+	return entries, nil
+}
+
+// DeleteUser removes the application with the given key from the whitelist.
+func (bridge *Bridge) DeleteUser(key string) ([]Result, error) {
+	var results []Result
+	err := bridge.delete("/config/whitelist/"+key, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// PruneWhitelist removes all applications which haven't accessed the bridge
+// for the given duration. The username of the bridge itself is never removed.
+// Returns all removed entries.
+func (bridge *Bridge) PruneWhitelist(unusedFor time.Duration) ([]WhitelistEntry, error) {
+	entries, err := bridge.Whitelist()
+	if err != nil {
+		return nil, err
+	}
+
+	threshold := time.Now().UTC().Add(-unusedFor)
+	var removed []WhitelistEntry
+	for _, entry := range entries {
+		if entry.Key == bridge.Username || entry.LastUsed().IsZero() || entry.LastUsed().After(threshold) {
+			continue
+		}
+		err = checkResults(bridge.DeleteUser(entry.Key))
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, entry)
+	}
+	return removed, nil
+}